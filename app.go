@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 	"io"
 
@@ -13,9 +14,35 @@ type App interface {
 	io.Closer
 
 	CreateWindow() (Window, error)
+	CreateWindowContext(ctx context.Context) (Window, error)
+	CreateWindowWithOptions(opts CreateWindowOptions) (Window, error)
+	CreateWindowWithOptionsContext(ctx context.Context, opts CreateWindowOptions) (Window, error)
 	ListWindows() ([]Window, error)
+	ListWindowsContext(ctx context.Context) ([]Window, error)
 	SelectMenuItem(item string) error
+	SelectMenuItemContext(ctx context.Context, item string) error
 	Activate(raiseAllWindows, ignoreOtherApps bool) error
+	ActivateContext(ctx context.Context, raiseAllWindows, ignoreOtherApps bool) error
+	Transaction(ctx context.Context, fn func(tx Tx) error) error
+	Capabilities() (Capabilities, error)
+	CapabilitiesContext(ctx context.Context) (Capabilities, error)
+	Snapshot() (*Snapshot, error)
+	SnapshotContext(ctx context.Context) (*Snapshot, error)
+	Model(ctx context.Context) (*Model, error)
+	SessionByID(id string) (Session, error)
+	SessionByIDContext(ctx context.Context, id string) (Session, error)
+	TabByID(id string) (Tab, error)
+	TabByIDContext(ctx context.Context, id string) (Tab, error)
+	WindowByNumber(number int) (Window, error)
+	WindowByNumberContext(ctx context.Context, number int) (Window, error)
+	FindSessions(match func(q *SessionQuery) bool) ([]Session, error)
+	FindSessionsContext(ctx context.Context, match func(q *SessionQuery) bool) ([]Session, error)
+	CurrentSession() (Session, error)
+	CurrentSessionContext(ctx context.Context) (Session, error)
+	// CloseTargets closes windows, tabs and sessions. It is
+	// not named Close, which closes the connection to iTerm2.
+	CloseTargets(force bool, targets ...Closable) ([]CloseResult, error)
+	CloseTargetsContext(ctx context.Context, force bool, targets ...Closable) ([]CloseResult, error)
 }
 
 // NewApp establishes a connection
@@ -26,7 +53,13 @@ type App interface {
 // require explicit permissions every
 // time you run the plugin.
 func NewApp(name string) (App, error) {
-	c, err := client.New(name)
+	return NewAppWithOptions(name, client.Options{})
+}
+
+// NewAppWithOptions is like NewApp but connects to iTerm2
+// according to the given client options.
+func NewAppWithOptions(name string, opts client.Options) (App, error) {
+	c, err := client.NewWithOptions(name, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -35,34 +68,54 @@ func NewApp(name string) (App, error) {
 }
 
 type app struct {
-	c *client.Client
+	c    *client.Client
+	inTx int32 // accessed atomically
 }
 
 func (a *app) Activate(raiseAllWindows bool, ignoreOtherApps bool) error {
-	_, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ActivateRequest{ActivateRequest: &api.ActivateRequest{
-			OrderWindowFront: b(true),
-			ActivateApp: &api.ActivateRequest_App{
-				RaiseAllWindows:   &raiseAllWindows,
-				IgnoringOtherApps: &ignoreOtherApps,
-			},
-		}},
+	return a.ActivateContext(context.Background(), raiseAllWindows, ignoreOtherApps)
+}
+
+func (a *app) ActivateContext(ctx context.Context, raiseAllWindows bool, ignoreOtherApps bool) error {
+	resp, err := a.c.Activate(ctx, &api.ActivateRequest{
+		OrderWindowFront: b(true),
+		ActivateApp: &api.ActivateRequest_App{
+			RaiseAllWindows:   &raiseAllWindows,
+			IgnoringOtherApps: &ignoreOtherApps,
+		},
 	})
-	return err
+	if err != nil {
+		return fmt.Errorf("error activating app: %w", err)
+	}
+	return client.CheckStatus("ActivateRequest", "", resp.GetStatus())
 }
 
 func (a *app) CreateWindow() (Window, error) {
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{
-			CreateTabRequest: &api.CreateTabRequest{},
-		},
+	return a.CreateWindowContext(context.Background())
+}
+
+func (a *app) CreateWindowContext(ctx context.Context) (Window, error) {
+	return a.CreateWindowWithOptionsContext(ctx, CreateWindowOptions{})
+}
+
+func (a *app) CreateWindowWithOptions(opts CreateWindowOptions) (Window, error) {
+	return a.CreateWindowWithOptionsContext(context.Background(), opts)
+}
+
+func (a *app) CreateWindowWithOptionsContext(ctx context.Context, opts CreateWindowOptions) (Window, error) {
+	props, err := opts.properties()
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := a.c.CreateTab(ctx, &api.CreateTabRequest{
+		ProfileName:             opts.profileName(),
+		CustomProfileProperties: props,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("could not create window tab: %w", err)
 	}
-	ctr := resp.GetCreateTabResponse()
-	if ctr.GetStatus() != api.CreateTabResponse_OK {
-		return nil, fmt.Errorf("unexpected window tab status: %s", ctr.GetStatus())
+	if err := client.CheckStatus("CreateTabRequest", "", ctr.GetStatus()); err != nil {
+		return nil, err
 	}
 	return &window{
 		c:       a.c,
@@ -72,16 +125,16 @@ func (a *app) CreateWindow() (Window, error) {
 }
 
 func (a *app) ListWindows() ([]Window, error) {
+	return a.ListWindowsContext(context.Background())
+}
+
+func (a *app) ListWindowsContext(ctx context.Context) ([]Window, error) {
 	list := []Window{}
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
-			ListSessionsRequest: &api.ListSessionsRequest{},
-		},
-	})
+	resp, err := a.c.ListSessions(ctx, &api.ListSessionsRequest{})
 	if err != nil {
 		return nil, fmt.Errorf("could not list sessions: %w", err)
 	}
-	for _, w := range resp.GetListSessionsResponse().GetWindows() {
+	for _, w := range resp.GetWindows() {
 		list = append(list, &window{
 			c:  a.c,
 			id: w.GetWindowId(),
@@ -102,19 +155,27 @@ func b(b bool) *bool {
 	return &b
 }
 
+// invokeError returns the error of a failed
+// function invocation on target, if any.
+func invokeError(target string, resp *api.InvokeFunctionResponse) error {
+	e := resp.GetError()
+	if e == nil {
+		return nil
+	}
+	err := client.CheckStatus("InvokeFunctionRequest", target, e.GetStatus())
+	return fmt.Errorf("%w: %s", err, e.GetErrorReason())
+}
+
 func (a *app) SelectMenuItem(item string) error {
-	resp, err := a.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_MenuItemRequest{
-			MenuItemRequest: &api.MenuItemRequest{
-				Identifier: &item,
-			},
-		},
+	return a.SelectMenuItemContext(context.Background(), item)
+}
+
+func (a *app) SelectMenuItemContext(ctx context.Context, item string) error {
+	resp, err := a.c.MenuItem(ctx, &api.MenuItemRequest{
+		Identifier: &item,
 	})
 	if err != nil {
 		return fmt.Errorf("error selecting menu item %q: %w", item, err)
 	}
-	if resp.GetMenuItemResponse().GetStatus() != api.MenuItemResponse_OK {
-		return fmt.Errorf("menu item %q returned unexpected status: %q", item, resp.GetMenuItemResponse().GetStatus().String())
-	}
-	return nil
+	return client.CheckStatus("MenuItemRequest", item, resp.GetStatus())
 }
@@ -0,0 +1,94 @@
+package iterm2_test
+
+import (
+	"testing"
+
+	"marwan.io/iterm2"
+	"marwan.io/iterm2/iterm2test"
+)
+
+// newApp connects a new App to a fresh fake iTerm2.
+func newApp(t *testing.T) (iterm2.App, *iterm2test.Server) {
+	t.Helper()
+	srv := iterm2test.NewServer()
+	t.Cleanup(srv.Close)
+	app, err := iterm2.NewAppWithOptions("test", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.Close() })
+	return app, srv
+}
+
+// newSession creates a window and returns its only session.
+func newSession(t *testing.T, app iterm2.App) iterm2.Session {
+	t.Helper()
+	w, err := app.CreateWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tabs, err := w.ListTabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := tabs[0].ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessions[0]
+}
+
+func TestApp(t *testing.T) {
+	app, srv := newApp(t)
+
+	windows, err := app.ListWindows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 0 {
+		t.Fatalf("expected no windows but got %d", len(windows))
+	}
+	w, err := app.CreateWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.CreateTab(); err != nil {
+		t.Fatal(err)
+	}
+	windows, err = app.ListWindows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 1 {
+		t.Fatalf("expected 1 window but got %d", len(windows))
+	}
+	tabs, err := windows[0].ListTabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tabs) != 2 {
+		t.Fatalf("expected 2 tabs but got %d", len(tabs))
+	}
+	sessions, err := tabs[1].ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session but got %d", len(sessions))
+	}
+	if err := sessions[0].SendText("echo hi\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.Input(sessions[0].GetSessionID()); got != "echo hi\n" {
+		t.Fatalf("expected input %q but got %q", "echo hi\n", got)
+	}
+	if err := sessions[0].Activate(true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Activate(true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.SelectMenuItem("Shell/New Tab"); err != nil {
+		t.Fatal(err)
+	}
+}
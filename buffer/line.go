@@ -0,0 +1,107 @@
+// Package buffer makes sense of the lines that iTerm2 returns
+// for a session's contents: it maps their text to the cells it
+// is drawn in and joins lines that were soft-wrapped back into
+// the logical lines that programs printed.
+//
+// This Package is EXPERIMENTAL and its APIs are likely
+// to change before becoming stable.
+package buffer
+
+import (
+	"sort"
+	"unicode/utf8"
+
+	"marwan.io/iterm2/api"
+)
+
+// Coord is the position of a cell. Y is a line number that
+// stays the same for a given line even after the oldest lines
+// of the scrollback history are lost.
+type Coord struct {
+	X int
+	Y int64
+}
+
+// CoordRange is a range of cells from Start up
+// to, but not including, End.
+type CoordRange struct {
+	Start, End Coord
+}
+
+// Continuation tells how a line ends.
+type Continuation int
+
+// The ways a line can end.
+const (
+	// HardEOL lines end where the program printed a newline.
+	HardEOL Continuation = iota + 1
+	// SoftEOL lines were wrapped: the next
+	// line continues where they stop.
+	SoftEOL
+)
+
+// Line is a line of text along with where its text sits on screen.
+type Line struct {
+	// Y is the line number of the line.
+	Y            int64
+	Text         string
+	Continuation Continuation
+	// Offsets maps cells to Text: cell x holds
+	// Text[Offsets[x]:Offsets[x+1]], which may be empty
+	// for blank cells or hold several code points for
+	// combining marks. Trailing blank cells are left out.
+	Offsets []int
+}
+
+// NewLine decodes the contents of line y.
+func NewLine(y int64, lc *api.LineContents) Line {
+	l := Line{
+		Y:            y,
+		Text:         lc.GetText(),
+		Continuation: HardEOL,
+	}
+	if lc.GetContinuation() == api.LineContents_CONTINUATION_SOFT_EOL {
+		l.Continuation = SoftEOL
+	}
+	offset := 0
+	l.Offsets = append(l.Offsets, offset)
+	for _, cpc := range lc.GetCodePointsPerCell() {
+		for r := int32(0); r < cpc.GetRepeats(); r++ {
+			for n := int32(0); n < cpc.GetNumCodePoints() && offset < len(l.Text); n++ {
+				_, size := utf8.DecodeRuneInString(l.Text[offset:])
+				offset += size
+			}
+			l.Offsets = append(l.Offsets, offset)
+		}
+	}
+	return l
+}
+
+// NumCells returns the number of cells that Offsets covers.
+func (l Line) NumCells() int {
+	if len(l.Offsets) == 0 {
+		return 0
+	}
+	return len(l.Offsets) - 1
+}
+
+// Cell returns the text of cell x.
+func (l Line) Cell(x int) string {
+	if x < 0 || x >= l.NumCells() {
+		return ""
+	}
+	return l.Text[l.Offsets[x]:l.Offsets[x+1]]
+}
+
+// CellAt returns the cell that holds the byte at offset
+// in Text, or -1 if no cell does.
+func (l Line) CellAt(offset int) int {
+	n := l.NumCells()
+	// Blank cells hold no bytes, so the first cell that
+	// ends past offset is also the one that holds it.
+	x := sort.Search(n, func(x int) bool { return l.Offsets[x+1] > offset })
+	if x == n || offset < l.Offsets[x] {
+		return -1
+	}
+	return x
+}
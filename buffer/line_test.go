@@ -0,0 +1,122 @@
+package buffer
+
+import (
+	"reflect"
+	"testing"
+
+	"marwan.io/iterm2/api"
+)
+
+// cells builds code_points_per_cell from pairs of
+// number of code points and repeats.
+func cells(pairs ...int32) []*api.CodePointsPerCell {
+	var list []*api.CodePointsPerCell
+	for i := 0; i < len(pairs); i += 2 {
+		n, r := pairs[i], pairs[i+1]
+		list = append(list, &api.CodePointsPerCell{NumCodePoints: &n, Repeats: &r})
+	}
+	return list
+}
+
+func contents(text string, soft bool, cpc []*api.CodePointsPerCell) *api.LineContents {
+	c := api.LineContents_CONTINUATION_HARD_EOL
+	if soft {
+		c = api.LineContents_CONTINUATION_SOFT_EOL
+	}
+	return &api.LineContents{Text: &text, Continuation: c.Enum(), CodePointsPerCell: cpc}
+}
+
+// compania is the example from the documentation of LineContents:
+// "xyz compañía" where the blank is an uninitialized cell and ñ and í
+// are made of a letter followed by a combining mark.
+const compania = "xyzcompan\u0303i\u0301a"
+
+func companiaContents() *api.LineContents {
+	return contents(compania, false, cells(1, 3, 0, 1, 1, 5, 2, 2, 1, 1))
+}
+
+func TestNewLine(t *testing.T) {
+	one, three := int32(1), int32(3)
+	tt := []struct {
+		name         string
+		lc           *api.LineContents
+		continuation Continuation
+		cells        []string
+	}{
+		{
+			name:         "compañía",
+			lc:           companiaContents(),
+			continuation: HardEOL,
+			cells:        []string{"x", "y", "z", "", "c", "o", "m", "p", "a", "n\u0303", "i\u0301", "a"},
+		},
+		{
+			name:         "soft wrapped",
+			lc:           contents("abc", true, cells(1, 3)),
+			continuation: SoftEOL,
+			cells:        []string{"a", "b", "c"},
+		},
+		{
+			name: "one code point per cell by default",
+			lc: contents("h\u00e9llo", false, []*api.CodePointsPerCell{
+				{Repeats: &one},
+				{Repeats: &one},
+				{Repeats: &three},
+			}),
+			continuation: HardEOL,
+			cells:        []string{"h", "\u00e9", "l", "l", "o"},
+		},
+		{
+			name:         "empty",
+			lc:           contents("", false, nil),
+			continuation: HardEOL,
+			cells:        nil,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			l := NewLine(7, tc.lc)
+			if l.Y != 7 {
+				t.Fatalf("expected line 7 but got %d", l.Y)
+			}
+			if l.Continuation != tc.continuation {
+				t.Fatalf("expected continuation %v but got %v", tc.continuation, l.Continuation)
+			}
+			var got []string
+			for x := 0; x < l.NumCells(); x++ {
+				got = append(got, l.Cell(x))
+			}
+			if !reflect.DeepEqual(got, tc.cells) {
+				t.Fatalf("expected cells %q but got %q", tc.cells, got)
+			}
+		})
+	}
+}
+
+func TestCellAt(t *testing.T) {
+	l := NewLine(0, companiaContents())
+	tt := []struct {
+		offset int
+		cell   int
+	}{
+		{0, 0},
+		{2, 2},
+		// The uninitialized cell 3 holds no text:
+		// the c right after z is in cell 4.
+		{3, 4},
+		{7, 8},
+		// n and its two byte combining tilde share cell 9.
+		{8, 9},
+		{9, 9},
+		{10, 9},
+		{11, 10},
+		{13, 10},
+		{14, 11},
+		{len(compania), -1},
+		{-1, -1},
+	}
+	for _, tc := range tt {
+		if got := l.CellAt(tc.offset); got != tc.cell {
+			t.Errorf("CellAt(%d): expected %d but got %d", tc.offset, tc.cell, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package buffer
+
+import "sort"
+
+// LogicalLine is a run of lines joined back together
+// where they were soft-wrapped.
+type LogicalLine struct {
+	Text string
+	// Lines are the lines that make up the logical line, in order.
+	Lines []Line
+	// starts holds the offset in Text where each of Lines starts.
+	starts []int
+}
+
+// Join groups lines, in order, into logical lines. Only the lines
+// it is given are joined: the first logical line may continue one
+// that precedes them and the last may go on past them.
+func Join(lines []Line) []*LogicalLine {
+	var list []*LogicalLine
+	var cur *LogicalLine
+	var text []byte
+	for _, l := range lines {
+		if cur == nil {
+			cur = &LogicalLine{}
+			text = text[:0]
+		}
+		cur.starts = append(cur.starts, len(text))
+		cur.Lines = append(cur.Lines, l)
+		text = append(text, l.Text...)
+		if l.Continuation != SoftEOL {
+			cur.Text = string(text)
+			list = append(list, cur)
+			cur = nil
+		}
+	}
+	if cur != nil {
+		cur.Text = string(text)
+		list = append(list, cur)
+	}
+	return list
+}
+
+// Start returns the first cell of the line.
+func (l *LogicalLine) Start() Coord {
+	if len(l.Lines) == 0 {
+		return Coord{}
+	}
+	return Coord{Y: l.Lines[0].Y}
+}
+
+// End returns the cell right after the last one of the line.
+func (l *LogicalLine) End() Coord {
+	if len(l.Lines) == 0 {
+		return Coord{}
+	}
+	last := l.Lines[len(l.Lines)-1]
+	return Coord{X: last.NumCells(), Y: last.Y}
+}
+
+// Coord returns the cell that holds the byte at offset in Text.
+// An offset that no cell holds, such as len(Text), maps to the
+// cell right after the text before it, which makes Coord fit
+// for the exclusive end of a range as well as its start.
+func (l *LogicalLine) Coord(offset int) Coord {
+	if offset < 0 {
+		return l.Start()
+	}
+	i := sort.Search(len(l.Lines), func(i int) bool {
+		return l.starts[i]+len(l.Lines[i].Text) > offset
+	})
+	if i == len(l.Lines) {
+		return l.End()
+	}
+	line := l.Lines[i]
+	if x := line.CellAt(offset - l.starts[i]); x >= 0 {
+		return Coord{X: x, Y: line.Y}
+	}
+	return Coord{X: line.NumCells(), Y: line.Y}
+}
+
+// Range returns the cells that hold Text[start:end],
+// such as the bounds of a regular expression match.
+func (l *LogicalLine) Range(start, end int) CoordRange {
+	return CoordRange{Start: l.Coord(start), End: l.Coord(end)}
+}
+
+// Index returns the offset in Text where the text of cell c
+// starts. Blank cells past the end of a line map to where its
+// text ends. It reports false if c is not part of the line.
+func (l *LogicalLine) Index(c Coord) (int, bool) {
+	if c.X < 0 {
+		return 0, false
+	}
+	for i, line := range l.Lines {
+		if line.Y != c.Y {
+			continue
+		}
+		x := c.X
+		if n := line.NumCells(); x > n {
+			x = n
+		}
+		if x >= len(line.Offsets) {
+			return l.starts[i], true
+		}
+		return l.starts[i] + line.Offsets[x], true
+	}
+	return 0, false
+}
@@ -0,0 +1,156 @@
+package buffer
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// lines are two soft-wrapped lines, an empty one,
+// the compañía example and a line that wraps past
+// the end of what was read.
+func lines() []Line {
+	return []Line{
+		NewLine(10, contents("error: some", true, cells(1, 11))),
+		NewLine(11, contents("thing bad", false, cells(1, 9))),
+		NewLine(12, contents("", false, nil)),
+		NewLine(13, companiaContents()),
+		NewLine(14, contents("ok", true, cells(1, 2))),
+	}
+}
+
+func TestJoin(t *testing.T) {
+	logical := Join(lines())
+	tt := []struct {
+		text       string
+		ys         []int64
+		start, end Coord
+	}{
+		{"error: something bad", []int64{10, 11}, Coord{0, 10}, Coord{9, 11}},
+		{"", []int64{12}, Coord{0, 12}, Coord{0, 12}},
+		{compania, []int64{13}, Coord{0, 13}, Coord{12, 13}},
+		{"ok", []int64{14}, Coord{0, 14}, Coord{2, 14}},
+	}
+	if len(logical) != len(tt) {
+		t.Fatalf("expected %d logical lines but got %d", len(tt), len(logical))
+	}
+	for i, tc := range tt {
+		l := logical[i]
+		if l.Text != tc.text {
+			t.Errorf("line %d: expected text %q but got %q", i, tc.text, l.Text)
+		}
+		var ys []int64
+		for _, line := range l.Lines {
+			ys = append(ys, line.Y)
+		}
+		if !reflect.DeepEqual(ys, tc.ys) {
+			t.Errorf("line %d: expected lines %v but got %v", i, tc.ys, ys)
+		}
+		if l.Start() != tc.start || l.End() != tc.end {
+			t.Errorf("line %d: expected %v-%v but got %v-%v", i, tc.start, tc.end, l.Start(), l.End())
+		}
+	}
+}
+
+func TestCoord(t *testing.T) {
+	logical := Join(lines())
+	wrapped, empty, example := logical[0], logical[1], logical[2]
+	tt := []struct {
+		name   string
+		line   *LogicalLine
+		offset int
+		coord  Coord
+	}{
+		{"wrapped start", wrapped, 0, Coord{0, 10}},
+		{"wrapped last cell of first line", wrapped, 10, Coord{10, 10}},
+		{"wrapped first cell of second line", wrapped, 11, Coord{0, 11}},
+		{"wrapped end", wrapped, len(wrapped.Text), Coord{9, 11}},
+		{"wrapped past end", wrapped, 100, Coord{9, 11}},
+		{"wrapped before start", wrapped, -1, Coord{0, 10}},
+		{"empty end", empty, len(empty.Text), Coord{0, 12}},
+		{"example after uninitialized cell", example, 3, Coord{4, 13}},
+		{"example combining tilde", example, 9, Coord{9, 13}},
+		{"example combining acute accent", example, 12, Coord{10, 13}},
+		{"example end", example, len(example.Text), Coord{12, 13}},
+	}
+	for _, tc := range tt {
+		if got := tc.line.Coord(tc.offset); got != tc.coord {
+			t.Errorf("%s: Coord(%d): expected %v but got %v", tc.name, tc.offset, tc.coord, got)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	logical := Join(lines())
+	wrapped, example := logical[0], logical[2]
+	tt := []struct {
+		name   string
+		line   *LogicalLine
+		coord  Coord
+		offset int
+		ok     bool
+	}{
+		{"wrapped second line", wrapped, Coord{0, 11}, 11, true},
+		{"wrapped blank cells past the end", wrapped, Coord{50, 11}, 20, true},
+		{"example uninitialized cell", example, Coord{3, 13}, 3, true},
+		{"example n with tilde", example, Coord{9, 13}, 8, true},
+		{"example a after i with acute accent", example, Coord{11, 13}, 14, true},
+		{"other line", wrapped, Coord{0, 12}, 0, false},
+		{"negative x", wrapped, Coord{-1, 10}, 0, false},
+	}
+	for _, tc := range tt {
+		offset, ok := tc.line.Index(tc.coord)
+		if offset != tc.offset || ok != tc.ok {
+			t.Errorf("%s: Index(%v): expected %d, %v but got %d, %v", tc.name, tc.coord, tc.offset, tc.ok, offset, ok)
+		}
+	}
+}
+
+func TestRangeIndexRoundTrip(t *testing.T) {
+	logical := Join(lines())
+	tt := []struct {
+		line  *LogicalLine
+		re    string
+		match CoordRange
+	}{
+		{logical[0], `something`, CoordRange{Coord{7, 10}, Coord{5, 11}}},
+		{logical[0], `some`, CoordRange{Coord{7, 10}, Coord{0, 11}}},
+		{logical[0], `bad$`, CoordRange{Coord{6, 11}, Coord{9, 11}}},
+		{logical[2], `compan\x{0303}i\x{0301}a`, CoordRange{Coord{4, 13}, Coord{12, 13}}},
+		{logical[2], `n\x{0303}`, CoordRange{Coord{9, 13}, Coord{10, 13}}},
+	}
+	for _, tc := range tt {
+		loc := regexp.MustCompile(tc.re).FindStringIndex(tc.line.Text)
+		if loc == nil {
+			t.Fatalf("%s: no match in %q", tc.re, tc.line.Text)
+		}
+		r := tc.line.Range(loc[0], loc[1])
+		if r != tc.match {
+			t.Errorf("%s: expected range %v but got %v", tc.re, tc.match, r)
+		}
+		start, ok := tc.line.Index(r.Start)
+		if !ok || start != loc[0] {
+			t.Errorf("%s: Index(%v): expected %d but got %d, %v", tc.re, r.Start, loc[0], start, ok)
+		}
+		end, ok := tc.line.Index(r.End)
+		if !ok || end != loc[1] {
+			t.Errorf("%s: Index(%v): expected %d but got %d, %v", tc.re, r.End, loc[1], end, ok)
+		}
+	}
+
+	// Every cell that holds text maps back to where its text starts.
+	for _, l := range logical {
+		for _, line := range l.Lines {
+			for x := 0; x < line.NumCells(); x++ {
+				if line.Cell(x) == "" {
+					continue
+				}
+				c := Coord{X: x, Y: line.Y}
+				offset, ok := l.Index(c)
+				if !ok || l.Coord(offset) != c {
+					t.Errorf("cell %v: Index gave %d, %v and Coord gave %v back", c, offset, ok, l.Coord(offset))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package iterm2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// probeID is an id that no window, tab or session has, so that
+// probing requests are answered without touching anything.
+const probeID = "iterm2-go-capability-probe"
+
+// Capabilities describes what the connected iTerm2 supports.
+type Capabilities struct {
+	// ProtocolVersion is the protocol version that iTerm2 reported
+	// during the handshake, such as "1.9". It is empty for
+	// versions that do not report one.
+	ProtocolVersion string
+
+	// Header holds every header of iTerm2's handshake response.
+	Header http.Header
+
+	// The following tell whether iTerm2 understands the
+	// requests that only newer versions support.
+	ListPrompts    bool
+	InvokeFunction bool
+	Close          bool
+}
+
+func (a *app) Capabilities() (Capabilities, error) {
+	return a.CapabilitiesContext(context.Background())
+}
+
+// CapabilitiesContext probes iTerm2 with harmless requests on every
+// call, so callers that need the result more than once should keep it.
+func (a *app) CapabilitiesContext(ctx context.Context) (Capabilities, error) {
+	h := a.c.Header()
+	caps := Capabilities{
+		ProtocolVersion: h.Get("X-iTerm2-Protocol-Version"),
+		Header:          h,
+	}
+	var err error
+	_, err = a.c.ListPrompts(ctx, &api.ListPromptsRequest{Session: str(probeID)})
+	if caps.ListPrompts, err = supported(err); err != nil {
+		return Capabilities{}, err
+	}
+	_, err = a.c.InvokeFunction(ctx, &api.InvokeFunctionRequest{
+		Invocation: str("iterm2.probe()"),
+		Context: &api.InvokeFunctionRequest_Method_{
+			Method: &api.InvokeFunctionRequest_Method{Receiver: str(probeID)},
+		},
+	})
+	if caps.InvokeFunction, err = supported(err); err != nil {
+		return Capabilities{}, err
+	}
+	_, err = a.c.CloseTargets(ctx, &api.CloseRequest{
+		Target: &api.CloseRequest_Sessions{
+			Sessions: &api.CloseRequest_CloseSessions{SessionIds: []string{probeID}},
+		},
+	})
+	if caps.Close, err = supported(err); err != nil {
+		return Capabilities{}, err
+	}
+	return caps, nil
+}
+
+// supported interprets the error of a probing request: only
+// ErrUnsupported means that iTerm2 did not understand it.
+func supported(err error) (bool, error) {
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, client.ErrUnsupported):
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,222 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/andybrewer/mack"
+)
+
+// ErrUnauthorized is returned when iTerm2
+// rejects the credentials of a handshake.
+var ErrUnauthorized = errors.New("iTerm2 rejected the credentials")
+
+// ErrNoCredentials is returned by an Authenticator
+// that has no credentials to offer.
+var ErrNoCredentials = errors.New("no credentials available")
+
+// Credentials are the cookie and key that
+// iTerm2 expects during the handshake.
+type Credentials struct {
+	Cookie string
+	Key    string
+}
+
+// Authenticator provides the credentials that a client
+// presents to iTerm2 when connecting.
+type Authenticator interface {
+	Credentials(ctx context.Context, appName string) (Credentials, error)
+}
+
+// Invalidator is implemented by authenticators that remember
+// credentials and need to forget them once iTerm2 rejects them.
+type Invalidator interface {
+	Invalidate(appName string, creds Credentials) error
+}
+
+// DefaultAuth returns the authenticators used when none are
+// configured: the ITERM2_COOKIE environment variable followed
+// by AppleScript.
+func DefaultAuth() []Authenticator {
+	return []Authenticator{
+		&EnvAuth{},
+		AppleScriptAuth{},
+	}
+}
+
+// StaticAuth always offers the same credentials.
+type StaticAuth Credentials
+
+// Credentials implements Authenticator
+func (s StaticAuth) Credentials(ctx context.Context, appName string) (Credentials, error) {
+	if s.Cookie == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return Credentials(s), nil
+}
+
+// EnvAuth reads the cookie from an environment variable.
+//
+// ITERM2_COOKIE is an an environment variable that's set on each terminal
+// session. But it only seems to work the first time, then it gets
+// invalidated. Therefore, once iTerm2 rejects a cookie, EnvAuth stops
+// offering it so that the next authenticator can generate a new one. See
+// https://github.com/marwan-at-work/iterm2/issues/4
+type EnvAuth struct {
+	// Name of the environment variable.
+	// Defaults to ITERM2_COOKIE.
+	Name string
+
+	mu       sync.Mutex
+	rejected string
+}
+
+// Credentials implements Authenticator
+func (e *EnvAuth) Credentials(ctx context.Context, appName string) (Credentials, error) {
+	name := e.Name
+	if name == "" {
+		name = "ITERM2_COOKIE"
+	}
+	cookie := os.Getenv(name)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if cookie == "" || cookie == e.rejected {
+		return Credentials{}, fmt.Errorf("%s: %w", name, ErrNoCredentials)
+	}
+	return Credentials{Cookie: cookie}, nil
+}
+
+// Invalidate implements Invalidator
+func (e *EnvAuth) Invalidate(appName string, creds Credentials) error {
+	e.mu.Lock()
+	e.rejected = creds.Cookie
+	e.mu.Unlock()
+	return nil
+}
+
+// AppleScriptAuth asks iTerm2 for a new cookie and key
+// through AppleScript. It only works on macOS.
+type AppleScriptAuth struct{}
+
+// Credentials implements Authenticator
+func (AppleScriptAuth) Credentials(ctx context.Context, appName string) (Credentials, error) {
+	resp, err := mack.Tell("iTerm2", fmt.Sprintf("request cookie and key for app named %q", appName))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("AppleScript/tell: %w", err)
+	}
+	fields := strings.Fields(resp)
+	if len(fields) != 2 {
+		return Credentials{}, fmt.Errorf("incorrect field format: %q", resp)
+	}
+	return Credentials{Cookie: fields[0], Key: fields[1]}, nil
+}
+
+// FileCache persists the credentials of another Authenticator on disk
+// so that they can be reused across runs. Cached credentials are
+// removed as soon as iTerm2 rejects them, after which the client
+// asks once more and the FileCache goes back to its Source.
+type FileCache struct {
+	// Path of the cache file. Defaults to iterm2/credentials.json
+	// inside the user's cache directory.
+	Path string
+
+	// Source provides credentials when
+	// the cache has none for an app.
+	Source Authenticator
+
+	mu sync.Mutex
+}
+
+// Credentials implements Authenticator
+func (f *FileCache) Credentials(ctx context.Context, appName string) (Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cache, err := f.load()
+	if err != nil {
+		return Credentials{}, err
+	}
+	if creds, ok := cache[appName]; ok {
+		return creds, nil
+	}
+	if f.Source == nil {
+		return Credentials{}, ErrNoCredentials
+	}
+	creds, err := f.Source.Credentials(ctx, appName)
+	if err != nil {
+		return Credentials{}, err
+	}
+	cache[appName] = creds
+	return creds, f.save(cache)
+}
+
+// Invalidate implements Invalidator
+func (f *FileCache) Invalidate(appName string, creds Credentials) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if inv, ok := f.Source.(Invalidator); ok {
+		inv.Invalidate(appName, creds)
+	}
+	cache, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := cache[appName]; !ok {
+		return nil
+	}
+	delete(cache, appName)
+	return f.save(cache)
+}
+
+func (f *FileCache) path() (string, error) {
+	if f.Path != "" {
+		return f.Path, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("os.UserCacheDir: %w", err)
+	}
+	return filepath.Join(dir, "iterm2", "credentials.json"), nil
+}
+
+func (f *FileCache) load() (map[string]Credentials, error) {
+	p, err := f.path()
+	if err != nil {
+		return nil, err
+	}
+	cache := map[string]Credentials{}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials cache: %w", err)
+	}
+	if err := json.Unmarshal(b, &cache); err != nil {
+		return nil, fmt.Errorf("error decoding credentials cache %q: %w", p, err)
+	}
+	return cache, nil
+}
+
+func (f *FileCache) save(cache map[string]Credentials) error {
+	p, err := f.path()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return fmt.Errorf("error creating credentials cache: %w", err)
+	}
+	if err := os.WriteFile(p, b, 0600); err != nil {
+		return fmt.Errorf("error writing credentials cache: %w", err)
+	}
+	return nil
+}
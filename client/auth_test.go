@@ -0,0 +1,109 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"marwan.io/iterm2/client"
+	"marwan.io/iterm2/iterm2test"
+)
+
+// countingAuth counts how often it is asked for credentials.
+type countingAuth struct {
+	client.StaticAuth
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingAuth) Credentials(ctx context.Context, appName string) (client.Credentials, error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+	return c.StaticAuth.Credentials(ctx, appName)
+}
+
+func writeCache(t *testing.T, cache map[string]client.Credentials) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "credentials.json")
+	b, err := json.Marshal(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func readCache(t *testing.T, p string) map[string]client.Credentials {
+	t.Helper()
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := map[string]client.Credentials{}
+	if err := json.Unmarshal(b, &cache); err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestFileCache(t *testing.T) {
+	stale := map[string]client.Credentials{"test": {Cookie: "stale"}}
+	tt := []struct {
+		name string
+		// source backs the FileCache and next comes after it.
+		source, next *countingAuth
+		cached       string
+		sourceCalls  int
+		nextCalls    int
+	}{
+		{
+			name:        "stale cache falls back to the source",
+			source:      &countingAuth{StaticAuth: client.StaticAuth{Cookie: iterm2test.Cookie}},
+			next:        &countingAuth{},
+			cached:      iterm2test.Cookie,
+			sourceCalls: 1,
+		},
+		{
+			name:        "rejected source moves on to the next provider",
+			source:      &countingAuth{StaticAuth: client.StaticAuth{Cookie: "also stale"}},
+			next:        &countingAuth{StaticAuth: client.StaticAuth{Cookie: iterm2test.Cookie}},
+			sourceCalls: 1,
+			nextCalls:   1,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := iterm2test.NewServer()
+			defer srv.Close()
+			p := writeCache(t, stale)
+			opts := srv.Options()
+			opts.Auth = []client.Authenticator{
+				&client.FileCache{Path: p, Source: tc.source},
+				tc.next,
+			}
+			c, err := client.NewWithOptions("test", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			if tc.source.calls != tc.sourceCalls || tc.next.calls != tc.nextCalls {
+				t.Fatalf("expected %d source and %d next calls but got %d and %d",
+					tc.sourceCalls, tc.nextCalls, tc.source.calls, tc.next.calls)
+			}
+			creds, ok := readCache(t, p)["test"]
+			if tc.cached == "" && ok {
+				t.Fatalf("expected no cached credentials but got %v", creds)
+			}
+			if creds.Cookie != tc.cached {
+				t.Fatalf("expected cached cookie %q but got %q", tc.cached, creds.Cookie)
+			}
+		})
+	}
+}
@@ -2,18 +2,14 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"sync"
-	"time"
 
-	"github.com/andybrewer/mack"
 	"github.com/gorilla/websocket"
 	"google.golang.org/protobuf/proto"
 	"marwan.io/iterm2/api"
@@ -24,156 +20,313 @@ import (
 // parameter is optional. If provided, it will bypass script authentication
 // prompts.
 func New(appName string) (*Client, error) {
-	// ITERM2_COOKIE is an an environment variable that's set on each terminal
-	// session. But it only seems to work the first time, then it gets
-	// invalidated. Therefore, we keep trying until it returns an error, then we
-	// try to generate a new cookie instead. See
-	// https://github.com/marwan-at-work/iterm2/issues/4
-	if cookie := os.Getenv("ITERM2_COOKIE"); cookie != "" {
-		client, err := newClient(appName, cookie)
-		if err == nil {
-			return client, nil
-		}
+	return NewWithOptions(appName, Options{})
+}
+
+// NewWithOptions is like New but lets the caller control how
+// the connection to iTerm2 is established.
+func NewWithOptions(appName string, opts Options) (*Client, error) {
+	if len(opts.Auth) == 0 {
+		// Resolved once so that authenticators remember
+		// rejected credentials across reconnects.
+		opts.Auth = DefaultAuth()
 	}
-	client, err := newClient(appName, "")
+	conn, header, err := dial(context.Background(), appName, opts)
 	if err != nil {
 		return nil, err
 	}
-	return client, err
+	cl := &Client{
+		appName:  appName,
+		opts:     opts,
+		c:        conn,
+		header:   header,
+		writes:   newWriteQueue(),
+		done:     make(chan struct{}),
+		subs:     make(map[subKey][]*Subscription),
+		subCalls: make(chan struct{}, 1),
+	}
+	cl.invoker = chainInterceptors(opts.Interceptors, cl.call)
+	cl.deliver = chainNotificationInterceptors(opts.NotificationInterceptors, cl.dispatch)
+	ctx, cancel := context.WithCancel(context.Background())
+	cl.cancel = cancel
+	cl.workers.Add(2)
+	go cl.readWorker(ctx)
+	go cl.writeWorker()
+	return cl, nil
+}
+
+// dial authenticates with each of the configured authenticators
+// in turn and opens a new websocket connection to iTerm2 with the
+// first credentials that iTerm2 accepts. It also returns the
+// headers of iTerm2's handshake response.
+func dial(ctx context.Context, appName string, opts Options) (*websocket.Conn, http.Header, error) {
+	var errs []string
+	for _, a := range opts.Auth {
+		// An authenticator that forgets rejected credentials is
+		// asked once more since it may then offer fresh ones, as
+		// a FileCache does by going to its Source.
+		for try := 0; try < 2; try++ {
+			creds, err := a.Credentials(ctx, appName)
+			if err != nil {
+				errs = append(errs, err.Error())
+				break
+			}
+			conn, header, err := connect(ctx, creds, opts)
+			if !errors.Is(err, ErrUnauthorized) {
+				return conn, header, err
+			}
+			errs = append(errs, err.Error())
+			inv, ok := a.(Invalidator)
+			if !ok {
+				break
+			}
+			inv.Invalidate(appName, creds)
+		}
+	}
+	return nil, nil, fmt.Errorf("could not authenticate with iTerm2: %s", strings.Join(errs, "; "))
 }
 
-func newClient(appName, cookie string) (*Client, error) {
+func connect(ctx context.Context, creds Credentials, opts Options) (*websocket.Conn, http.Header, error) {
 	h := http.Header{}
+	for k, v := range opts.Header {
+		h[k] = append([]string(nil), v...)
+	}
 	h.Set("origin", "ws://localhost/")
 	h.Set("x-iterm2-library-version", "go 3.6")
 	h.Set("x-iterm2-disable-auth-ui", "true")
-	if cookie == "" {
-		resp, err := mack.Tell("iTerm2", fmt.Sprintf("request cookie and key for app named %q", appName))
-		if err != nil {
-			return nil, fmt.Errorf("AppleScript/tell: %w", err)
-		}
-		fields := strings.Fields(resp)
-		if len(fields) != 2 {
-			return nil, fmt.Errorf("incorrect field format: %q", resp)
-		}
-		cookie = fields[0]
-		h.Set("x-iterm2-key", fields[1])
+	h.Set("x-iterm2-cookie", creds.Cookie)
+	if creds.Key != "" {
+		h.Set("x-iterm2-key", creds.Key)
 	}
-	h.Set("x-iterm2-cookie", cookie)
-	homeDir, err := os.UserHomeDir()
+	d, url, err := opts.dialer()
 	if err != nil {
-		return nil, fmt.Errorf("os.UserHomeDir: %w", err)
+		return nil, nil, err
 	}
-	d := &websocket.Dialer{
-		NetDial: func(network, addr string) (net.Conn, error) {
-			return net.Dial("unix", filepath.Join(homeDir, "/Library/Application Support/iTerm2/private/socket"))
-		},
-		HandshakeTimeout: 45 * time.Second,
-		Subprotocols:     []string{"api.iterm2.com"},
+	c, resp, err := d.DialContext(ctx, url, h)
+	if err != nil && resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		return nil, nil, fmt.Errorf("error connecting to iTerm2: %w", ErrUnauthorized)
 	}
-	c, resp, err := d.Dial("ws://localhost", h)
 	if err != nil && resp != nil {
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("error connecting to iTerm2: %v - body: %s", err, b)
+		return nil, nil, fmt.Errorf("error connecting to iTerm2: %v - body: %s", err, b)
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error connecting to iTerm2: %v", err)
+		return nil, nil, fmt.Errorf("error connecting to iTerm2: %v", err)
 	}
-	cl := &Client{
-		c:       c,
-		rpcs:    make(map[int64]chan<- *api.ServerOriginatedMessage),
-		writeCh: make(chan writeReq),
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	cl.cancel = cancel
-	go cl.readWorker(ctx)
-	go cl.writeWorker()
-	return cl, nil
+	return c, resp.Header, nil
 }
 
+// ErrClosed is returned by calls made on, or
+// still pending when, a Client is closed.
+var ErrClosed = errors.New("client is closed")
+
 // Client wraps a websocket client connection to iTerm2.
 // Must be instantiated with NewClient.
 type Client struct {
+	appName string
+	opts    Options
+	invoker Invoker
+	deliver func(*api.Notification)
+	connMu  sync.Mutex
 	c       *websocket.Conn
-	rpcs    map[int64]chan<- *api.ServerOriginatedMessage
-	mu      sync.Mutex
+	header  http.Header
+	calls   pending
 	cancel  context.CancelFunc
-	writeCh chan writeReq
+	writes  *writeQueue
+	done    chan struct{}
+	workers sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
+
+	subMu sync.Mutex
+	subs  map[subKey][]*Subscription
+	// subCalls is held while registering or dropping subscriptions
+	// with iTerm2. It is a channel so that waiting for it can be
+	// given up on.
+	subCalls chan struct{}
+
+	stateMu   sync.Mutex
+	state     ConnState
+	observers []*stateObserver
+}
+
+// result is what a pending call receives:
+// either a response or the reason there won't be one.
+type result struct {
+	msg *api.ServerOriginatedMessage
+	err error
 }
 
-type writeReq struct {
-	msg  []byte
-	resp chan error
+// conn returns the current websocket connection.
+func (c *Client) conn() *websocket.Conn {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.c
+}
+
+// Header returns the headers that iTerm2 answered the
+// handshake of the current connection with.
+func (c *Client) Header() http.Header {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.header.Clone()
 }
 
 func (c *Client) writeWorker() {
-	for req := range c.writeCh {
-		err := c.c.WriteMessage(websocket.BinaryMessage, req.msg)
-		req.resp <- err
+	defer c.workers.Done()
+	for {
+		select {
+		case <-c.writes.wake:
+		case <-c.done:
+			return
+		}
+		reqs := c.writes.drain()
+		if err := c.writeBatch(c.conn(), reqs); err != nil {
+			// Writes only fail on a broken connection, which the
+			// read worker is about to notice or is replacing.
+			err = fmt.Errorf("error writing to websocket: %w: %v", ErrConnectionLost, err)
+			for _, r := range reqs {
+				if ch, ok := c.calls.take(r.id); ok {
+					ch <- result{err: err}
+				}
+			}
+		}
+		for _, r := range reqs {
+			releaseBuffer(r.buf)
+		}
+		c.writes.recycle(reqs)
 	}
 }
 
 func (c *Client) readWorker(ctx context.Context) {
+	defer c.workers.Done()
 	for {
-		_, msg, err := c.c.ReadMessage()
+		_, msg, err := c.conn().ReadMessage()
 		if ctx.Err() != nil {
 			return
 		}
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			c.log().Warn("iterm2: connection lost", "error", err)
+			if !c.reconnect(ctx, err) {
+				return
+			}
 			continue
 		}
+		if c.opts.Recorder != nil {
+			c.opts.Recorder.record(Received, msg)
+		}
 		var resp api.ServerOriginatedMessage
 		err = proto.Unmarshal(msg, &resp)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			c.log().Error("iterm2: could not decode message", "size", len(msg), "error", err)
+			continue
+		}
+		if n := resp.GetNotification(); n != nil {
+			c.deliver(n)
 			continue
 		}
-		c.mu.Lock()
-		ch, ok := c.rpcs[resp.GetId()]
-		delete(c.rpcs, resp.GetId())
-		c.mu.Unlock()
+		ch, ok := c.calls.take(resp.GetId())
 		if !ok {
-			fmt.Fprintf(os.Stderr, "could not find call for %d: %v\n", resp.GetId(), &resp)
+			c.orphan(&resp, c.calls.issued(resp.GetId()))
 			continue
 		}
-		ch <- &resp
+		ch <- result{msg: &resp}
 	}
 }
 
 // Call sends a request to the iTerm2 server
 func (c *Client) Call(req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
-	req.Id = id(rand.Int63())
-	ch := make(chan *api.ServerOriginatedMessage, 1)
-	c.mu.Lock()
-	c.rpcs[req.GetId()] = ch
-	c.mu.Unlock()
-	msg, err := proto.Marshal(req)
+	return c.CallContext(context.Background(), req)
+}
+
+// CallContext sends a request to the iTerm2 server and waits
+// for its response. If ctx is done before iTerm2 answers,
+// the pending call is discarded and ctx.Err() is returned.
+// Once the client is closed, CallContext returns ErrClosed.
+func (c *Client) CallContext(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+	return c.invoker(ctx, req)
+}
+
+// call is the Invoker at the end of the interceptor chain.
+func (c *Client) call(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+	ch := resultPool.Get().(chan result)
+	reqID, err := c.calls.add(ch)
 	if err != nil {
+		resultPool.Put(ch)
 		return nil, err
 	}
-	wr := writeReq{msg: msg, resp: make(chan error, 1)}
-	c.writeCh <- wr
-	err = <-wr.resp
+	req.Id = &reqID
+	buf, err := marshal(req)
 	if err != nil {
-		return nil, fmt.Errorf("error writing to websocket: %w", err)
+		c.forget(reqID, ch)
+		return nil, err
+	}
+	// From here on, the buffer belongs to the write worker.
+	c.writes.push(writeReq{id: reqID, buf: buf})
+	var res result
+	select {
+	case res = <-ch:
+		resultPool.Put(ch)
+	case <-ctx.Done():
+		c.forget(reqID, ch)
+		return nil, ctx.Err()
+	case <-c.done:
+		c.forget(reqID, ch)
+		return nil, ErrClosed
+	}
+	if res.err != nil {
+		return nil, res.err
 	}
-	resp := <-ch
+	resp := res.msg
 	if resp.GetError() != "" {
-		return nil, fmt.Errorf("error from server: %v", resp.GetError())
+		return nil, &ServerError{Request: requestKind(req), Message: resp.GetError()}
 	}
 	return resp, nil
 }
 
-// Close closes the websocket connection
-// and frees any goroutine resources
-func (c *Client) Close() error {
-	// TODO: if a *Client.Call is in flight, this will cause it to panic
-	close(c.writeCh)
-	c.cancel()
-	return c.c.Close()
+// forget removes a pending call so that a late response does
+// not get delivered to anyone. ch is only recycled if no one
+// else took the call, since they may be sending to it.
+func (c *Client) forget(id int64, ch chan result) {
+	if _, ok := c.calls.take(id); ok {
+		resultPool.Put(ch)
+	}
 }
 
-func id(i int64) *int64 {
-	return &i
+// Close closes the websocket connection and frees any goroutine
+// resources. Calls that are still waiting for a response, as well
+// as any later ones, fail with ErrClosed. Close is safe to call
+// more than once and from multiple goroutines. It waits for the
+// goroutine that reads from the connection to exit, so it must not
+// be called from the callbacks that goroutine runs: OnStateChange
+// observers, NotificationInterceptors, Options.OnOrphan and
+// Options.Logger.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.cancel()
+		c.setState(StateClosed)
+		c.calls.close()
+		// Stopped without holding subMu, which an
+		// Unsubscribe in progress may be waiting for.
+		c.subMu.Lock()
+		var subs []*Subscription
+		for _, list := range c.subs {
+			subs = append(subs, list...)
+		}
+		c.subMu.Unlock()
+		for _, s := range subs {
+			s.stop()
+		}
+		c.connMu.Lock()
+		// The connection is already closed if it was lost
+		// and the client has not reconnected yet.
+		if err := c.c.Close(); !errors.Is(err, net.ErrClosed) {
+			c.closeErr = err
+		}
+		c.connMu.Unlock()
+		c.workers.Wait()
+	})
+	return c.closeErr
 }
@@ -0,0 +1,249 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+	"marwan.io/iterm2/iterm2test"
+)
+
+// echo answers variable requests with the names they ask
+// for, which tells every call's response apart.
+func echo(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+	vr := req.GetVariableRequest()
+	if vr == nil {
+		return nil
+	}
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_VariableResponse{VariableResponse: &api.VariableResponse{
+			Status: api.VariableResponse_OK.Enum(),
+			Values: vr.GetGet(),
+		}},
+	}
+}
+
+func variableRequest(name string) *api.ClientOriginatedMessage {
+	return &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_VariableRequest{VariableRequest: &api.VariableRequest{
+			Scope: &api.VariableRequest_App{App: true},
+			Get:   []string{name},
+		}},
+	}
+}
+
+func TestParallelCalls(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	srv.Handle(echo)
+
+	var mu sync.Mutex
+	orphans := map[client.OrphanReason]int{}
+	opts := srv.Options()
+	opts.OnOrphan = func(resp *api.ServerOriginatedMessage, reason client.OrphanReason) {
+		mu.Lock()
+		orphans[reason]++
+		mu.Unlock()
+	}
+	c, err := client.NewWithOptions("test", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const calls = 5000
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := context.Background()
+			expiring := i%10 == 0
+			if expiring {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Duration(i%7)*time.Microsecond)
+				defer cancel()
+			}
+			name := strconv.Itoa(i)
+			resp, err := c.CallContext(ctx, variableRequest(name))
+			if err != nil {
+				if !expiring || !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("call %d: %v", i, err)
+				}
+				return
+			}
+			values := resp.GetVariableResponse().GetValues()
+			if len(values) != 1 || values[0] != name {
+				t.Errorf("call %d got the response to %v", i, values)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// The responses to abandoned calls may still be on their way.
+	if _, err := c.Call(variableRequest("last")); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for reason, n := range orphans {
+		if reason != client.OrphanAbandoned {
+			t.Fatalf("got %d orphans for reason %v", n, reason)
+		}
+	}
+}
+
+func newBenchClient(b *testing.B) *client.Client {
+	b.Helper()
+	srv := iterm2test.NewServer()
+	b.Cleanup(srv.Close)
+	srv.Handle(echo)
+	c, err := client.NewWithOptions("bench", srv.Options())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { c.Close() })
+	return c
+}
+
+func BenchmarkCall(b *testing.B) {
+	c := newBenchClient(b)
+	req := variableRequest("bench")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Call(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCallParallel(b *testing.B) {
+	c := newBenchClient(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		req := variableRequest("bench")
+		for pb.Next() {
+			if _, err := c.Call(req); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func TestUnsupported(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetInvokeFunctionRequest() == nil {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_Error{Error: "malformed invocation"},
+		}
+	})
+	c, err := client.NewWithOptions("test", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	// The fake server answers ListPromptsRequest like a
+	// version of iTerm2 that does not know it.
+	_, err = c.ListPrompts(ctx, &api.ListPromptsRequest{})
+	if !errors.Is(err, client.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported but got %v", err)
+	}
+	_, err = c.InvokeFunction(ctx, &api.InvokeFunctionRequest{})
+	var se *client.ServerError
+	if errors.Is(err, client.ErrUnsupported) || !errors.As(err, &se) {
+		t.Fatalf("expected a plain ServerError but got %v", err)
+	}
+}
+
+func TestOnStateChangeRemove(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var mu sync.Mutex
+	var removed []client.ConnState
+	remove := c.OnStateChange(func(s client.ConnState) {
+		mu.Lock()
+		removed = append(removed, s)
+		mu.Unlock()
+	})
+	remove()
+	connected := make(chan struct{}, 1)
+	c.OnStateChange(func(s client.ConnState) {
+		if s == client.StateConnected {
+			connected <- struct{}{}
+		}
+	})
+	srv.DropConnections()
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the client to reconnect")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(removed) != 0 {
+		t.Fatalf("removed observer was called with %v", removed)
+	}
+}
+
+func TestSubscribeManyOrder(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan *api.Notification, 100)
+	subs, err := c.SubscribeMany(context.Background(), []*api.NotificationRequest{
+		{NotificationType: api.NotificationType_NOTIFY_ON_NEW_SESSION.Enum()},
+		{NotificationType: api.NotificationType_NOTIFY_ON_TERMINATE_SESSION.Enum()},
+	}, func(n *api.Notification) { got <- n })
+	if err != nil {
+		t.Fatal(err)
+	}
+	const events = 50
+	for i := 0; i < events; i++ {
+		id := strconv.Itoa(i)
+		n := &api.Notification{NewSessionNotification: &api.NewSessionNotification{SessionId: &id}}
+		if i%2 == 1 {
+			n = &api.Notification{TerminateSessionNotification: &api.TerminateSessionNotification{SessionId: &id}}
+		}
+		srv.Notify(n)
+	}
+	for i := 0; i < events; i++ {
+		var n *api.Notification
+		select {
+		case n = <-got:
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a notification")
+		}
+		id := n.GetNewSessionNotification().GetSessionId() + n.GetTerminateSessionNotification().GetSessionId()
+		if id != strconv.Itoa(i) {
+			t.Fatalf("notification %d arrived out of order: %v", i, n)
+		}
+	}
+	for _, s := range subs {
+		if err := s.Unsubscribe(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"marwan.io/iterm2/api"
+)
+
+// Sentinel errors for every non-OK status that iTerm2 can answer
+// with. A StatusError wraps the one matching its status so that
+// callers can check for it with errors.Is regardless of which
+// request it came from.
+var (
+	ErrAlreadyInTransaction           = errors.New("already in transaction")
+	ErrAlreadySubscribed              = errors.New("already subscribed")
+	ErrArrangementNotFound            = errors.New("arrangement not found")
+	ErrBadGUID                        = errors.New("bad GUID")
+	ErrBadIdentifier                  = errors.New("bad identifier")
+	ErrBadJSON                        = errors.New("bad JSON")
+	ErrBadTabID                       = errors.New("bad tab ID")
+	ErrBroadcastDomainsNotDisjoint    = errors.New("broadcast domains not disjoint")
+	ErrCannotSplit                    = errors.New("cannot split")
+	ErrDeferred                       = errors.New("deferred")
+	ErrDisabled                       = errors.New("disabled")
+	ErrDuplicateServerOriginatedRPC   = errors.New("duplicate server originated RPC")
+	ErrGeneric                        = errors.New("unspecified error")
+	ErrFailed                         = errors.New("failed")
+	ErrImpossible                     = errors.New("impossible")
+	ErrInvalidAssignment              = errors.New("invalid assignment")
+	ErrInvalidConnectionID            = errors.New("invalid connection ID")
+	ErrInvalidID                      = errors.New("invalid ID")
+	ErrInvalidIdentifier              = errors.New("invalid identifier")
+	ErrInvalidLineRange               = errors.New("invalid line range")
+	ErrInvalidName                    = errors.New("invalid name")
+	ErrInvalidOption                  = errors.New("invalid option")
+	ErrInvalidProfileName             = errors.New("invalid profile name")
+	ErrInvalidRange                   = errors.New("invalid range")
+	ErrInvalidRequest                 = errors.New("invalid request")
+	ErrInvalidSession                 = errors.New("invalid session")
+	ErrInvalidSize                    = errors.New("invalid size")
+	ErrInvalidTabID                   = errors.New("invalid tab ID")
+	ErrInvalidTabIndex                = errors.New("invalid tab index")
+	ErrInvalidTarget                  = errors.New("invalid target")
+	ErrInvalidValue                   = errors.New("invalid value")
+	ErrInvalidWindowID                = errors.New("invalid window ID")
+	ErrMalformedCustomProfileProperty = errors.New("malformed custom profile property")
+	ErrMissingScope                   = errors.New("missing scope")
+	ErrMissingSubstitution            = errors.New("missing substitution")
+	ErrMultiGetDisallowed             = errors.New("multi get disallowed")
+	ErrNotFound                       = errors.New("not found")
+	ErrNotSubscribed                  = errors.New("not subscribed")
+	ErrNoTransaction                  = errors.New("no transaction")
+	ErrPermissionDenied               = errors.New("permission denied")
+	ErrPresetNotFound                 = errors.New("preset not found")
+	ErrPromptUnavailable              = errors.New("prompt unavailable")
+	ErrRequestMalformed               = errors.New("request malformed")
+	ErrSessionsNotInSameWindow        = errors.New("sessions not in same window")
+	ErrSessionNotFound                = errors.New("session not found")
+	ErrSessionNotRestartable          = errors.New("session not restartable")
+	ErrTabNotFound                    = errors.New("tab not found")
+	ErrTimeout                        = errors.New("timeout")
+	ErrUnrecognizedName               = errors.New("unrecognized name")
+	ErrUserDeclined                   = errors.New("user declined")
+	ErrWindowNotFound                 = errors.New("window not found")
+	ErrWrongTree                      = errors.New("wrong tree")
+)
+
+var statusErrors = map[protoreflect.Name]error{
+	"ALREADY_IN_TRANSACTION":            ErrAlreadyInTransaction,
+	"ALREADY_SUBSCRIBED":                ErrAlreadySubscribed,
+	"ARRANGEMENT_NOT_FOUND":             ErrArrangementNotFound,
+	"BAD_GUID":                          ErrBadGUID,
+	"BAD_IDENTIFIER":                    ErrBadIdentifier,
+	"BAD_JSON":                          ErrBadJSON,
+	"BAD_TAB_ID":                        ErrBadTabID,
+	"BROADCAST_DOMAINS_NOT_DISJOINT":    ErrBroadcastDomainsNotDisjoint,
+	"CANNOT_SPLIT":                      ErrCannotSplit,
+	"DEFERRED":                          ErrDeferred,
+	"DISABLED":                          ErrDisabled,
+	"DUPLICATE_SERVER_ORIGINATED_RPC":   ErrDuplicateServerOriginatedRPC,
+	"ERROR":                             ErrGeneric,
+	"FAILED":                            ErrFailed,
+	"IMPOSSIBLE":                        ErrImpossible,
+	"INVALID_ASSIGNMENT":                ErrInvalidAssignment,
+	"INVALID_CONNECTION_ID":             ErrInvalidConnectionID,
+	"INVALID_ID":                        ErrInvalidID,
+	"INVALID_IDENTIFIER":                ErrInvalidIdentifier,
+	"INVALID_LINE_RANGE":                ErrInvalidLineRange,
+	"INVALID_NAME":                      ErrInvalidName,
+	"INVALID_OPTION":                    ErrInvalidOption,
+	"INVALID_PROFILE_NAME":              ErrInvalidProfileName,
+	"INVALID_RANGE":                     ErrInvalidRange,
+	"INVALID_REQUEST":                   ErrInvalidRequest,
+	"INVALID_SESSION":                   ErrInvalidSession,
+	"INVALID_SIZE":                      ErrInvalidSize,
+	"INVALID_TAB_ID":                    ErrInvalidTabID,
+	"INVALID_TAB_INDEX":                 ErrInvalidTabIndex,
+	"INVALID_TARGET":                    ErrInvalidTarget,
+	"INVALID_VALUE":                     ErrInvalidValue,
+	"INVALID_WINDOW_ID":                 ErrInvalidWindowID,
+	"MALFORMED_CUSTOM_PROFILE_PROPERTY": ErrMalformedCustomProfileProperty,
+	"MISSING_SCOPE":                     ErrMissingScope,
+	"MISSING_SUBSTITUTION":              ErrMissingSubstitution,
+	"MULTI_GET_DISALLOWED":              ErrMultiGetDisallowed,
+	"NOT_FOUND":                         ErrNotFound,
+	"NOT_SUBSCRIBED":                    ErrNotSubscribed,
+	"NO_TRANSACTION":                    ErrNoTransaction,
+	"PERMISSION_DENIED":                 ErrPermissionDenied,
+	"PRESET_NOT_FOUND":                  ErrPresetNotFound,
+	"PROMPT_UNAVAILABLE":                ErrPromptUnavailable,
+	"REQUEST_MALFORMED":                 ErrRequestMalformed,
+	"SESSIONS_NOT_IN_SAME_WINDOW":       ErrSessionsNotInSameWindow,
+	"SESSION_NOT_FOUND":                 ErrSessionNotFound,
+	"SESSION_NOT_RESTARTABLE":           ErrSessionNotRestartable,
+	"TAB_NOT_FOUND":                     ErrTabNotFound,
+	"TIMEOUT":                           ErrTimeout,
+	"UNRECOGNIZED_NAME":                 ErrUnrecognizedName,
+	"USER_DECLINED":                     ErrUserDeclined,
+	"WINDOW_NOT_FOUND":                  ErrWindowNotFound,
+	"WRONG_TREE":                        ErrWrongTree,
+}
+
+// StatusError reports a response whose status was not OK.
+type StatusError struct {
+	// Request is the kind of request, such as "SplitPaneRequest".
+	Request string
+	// Target is the id of the window, tab or session the
+	// request was about. It is empty for app-wide requests.
+	Target string
+	// Status is the status enum from the response,
+	// such as api.SplitPaneResponse_CANNOT_SPLIT.
+	Status protoreflect.Enum
+}
+
+// Name returns the name of the status, such as CANNOT_SPLIT.
+func (e *StatusError) Name() protoreflect.Name {
+	return statusName(e.Status)
+}
+
+func (e *StatusError) Error() string {
+	if e.Target == "" {
+		return fmt.Sprintf("unexpected status for %s: %s", e.Request, e.Name())
+	}
+	return fmt.Sprintf("unexpected status for %s %q: %s", e.Request, e.Target, e.Name())
+}
+
+// Unwrap returns the sentinel error for the status.
+func (e *StatusError) Unwrap() error {
+	return statusErrors[e.Name()]
+}
+
+// CheckStatus returns a *StatusError for status unless it is OK.
+func CheckStatus(request, target string, status protoreflect.Enum) error {
+	if statusName(status) == "OK" {
+		return nil
+	}
+	return &StatusError{Request: request, Target: target, Status: status}
+}
+
+func statusName(status protoreflect.Enum) protoreflect.Name {
+	v := status.Descriptor().Values().ByNumber(status.Number())
+	if v == nil {
+		return protoreflect.Name(fmt.Sprint(status.Number()))
+	}
+	return v.Name()
+}
+
+// ServerError is the error iTerm2 answers with when it
+// could not process a request at all, for example because
+// it was malformed or is unknown to this version of iTerm2.
+type ServerError struct {
+	// Request is the kind of request, such as "SplitPaneRequest".
+	Request string
+	// Message is the error string sent by iTerm2.
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("error from server for %s: %s", e.Request, e.Message)
+}
+
+// ErrUnsupported is returned when the connected
+// iTerm2 is too old to know about a request.
+var ErrUnsupported = errors.New("not supported by this version of iTerm2")
+
+// UnsupportedError is returned by requests that only newer versions
+// of iTerm2 understand when the server rejects them as unknown.
+// It matches ErrUnsupported with errors.Is.
+type UnsupportedError struct {
+	// Request is the kind of request, such as ListPromptsRequest.
+	Request string
+	// Err is the error iTerm2 answered with.
+	Err *ServerError
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s is not supported by this version of iTerm2: %s", e.Request, e.Err.Message)
+}
+
+// Is reports whether target is ErrUnsupported.
+func (e *UnsupportedError) Is(target error) bool {
+	return target == ErrUnsupported
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return e.Err
+}
+
+// unknownRequestErrors are the messages iTerm2 rejects requests it
+// does not know with. Versions that predate a request drop its
+// fields while decoding it and are left with no submessage, which
+// iTermAPIServer answers with "Invalid request".
+var unknownRequestErrors = []string{
+	"invalid request",
+}
+
+// unsupported turns the server error of a request that older
+// iTerm2 versions do not know into an UnsupportedError when it
+// says that the request is unknown. Other errors are left as is.
+func unsupported(request string, err error) error {
+	var se *ServerError
+	if !errors.As(err, &se) {
+		return err
+	}
+	msg := strings.ToLower(strings.TrimSpace(se.Message))
+	for _, e := range unknownRequestErrors {
+		if msg == e {
+			return &UnsupportedError{Request: request, Err: se}
+		}
+	}
+	return err
+}
+
+// ErrUnexpectedResponse is returned when iTerm2 answers
+// a request with a response of the wrong kind.
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+func unexpectedResponse(request string, resp *api.ServerOriginatedMessage) error {
+	return fmt.Errorf("%w to %s: %s", ErrUnexpectedResponse, request, submessageKind(resp))
+}
+
+// requestKind returns the name of the request
+// a message carries, such as SplitPaneRequest.
+func requestKind(req *api.ClientOriginatedMessage) string {
+	kind := submessageKind(req)
+	if kind == "unknown" {
+		return "unknown request"
+	}
+	return kind
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+
+	"marwan.io/iterm2/api"
+)
+
+// Invoker sends a request to iTerm2 and returns its response.
+type Invoker func(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error)
+
+// Interceptor wraps every call a Client makes. It sees the request
+// before it is sent and the response or error once it comes back,
+// and is responsible for calling invoker to continue the call. An
+// interceptor may call invoker more than once, for example to retry,
+// or not at all to answer on iTerm2's behalf.
+type Interceptor func(ctx context.Context, req *api.ClientOriginatedMessage, invoker Invoker) (*api.ServerOriginatedMessage, error)
+
+// NotificationInterceptor wraps the delivery of every notification
+// to subscriptions. Calling next continues the delivery; not calling
+// it drops the notification. It runs on the goroutine that reads from
+// the connection and therefore must not block or call Close.
+type NotificationInterceptor func(n *api.Notification, next func(*api.Notification))
+
+// chainInterceptors returns an Invoker that runs the interceptors
+// in order, the first one being the outermost, before calling final.
+func chainInterceptors(interceptors []Interceptor, final Invoker) Invoker {
+	invoker := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, error) {
+			return ic(ctx, req, next)
+		}
+	}
+	return invoker
+}
+
+// chainNotificationInterceptors is like chainInterceptors for notifications.
+func chainNotificationInterceptors(interceptors []NotificationInterceptor, final func(*api.Notification)) func(*api.Notification) {
+	deliver := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, next := interceptors[i], deliver
+		deliver = func(n *api.Notification) {
+			ic(n, next)
+		}
+	}
+	return deliver
+}
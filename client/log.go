@@ -0,0 +1,49 @@
+package client
+
+import (
+	"google.golang.org/protobuf/proto"
+)
+
+// Logger receives the events that a Client cannot report to any
+// caller, such as a dropped connection or a response nobody waits
+// for. Its methods take a message followed by alternating keys and
+// values, so a *slog.Logger can be used as is.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// nopLogger is the Logger used when none is configured.
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+func (c *Client) log() Logger {
+	if c.opts.Logger == nil {
+		return nopLogger{}
+	}
+	return c.opts.Logger
+}
+
+// submessageKind returns the name of what a message
+// carries, such as SplitPaneResponse or error.
+func submessageKind(m proto.Message) string {
+	r := m.ProtoReflect()
+	od := r.Descriptor().Oneofs().ByName("submessage")
+	if od == nil {
+		return "unknown"
+	}
+	fd := r.WhichOneof(od)
+	if fd == nil {
+		return "unknown"
+	}
+	if fd.Message() == nil {
+		return string(fd.Name())
+	}
+	return string(fd.Message().Name())
+}
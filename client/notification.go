@@ -0,0 +1,361 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"marwan.io/iterm2/api"
+)
+
+// Subscription is a registered interest in one kind of iTerm2
+// notification. Notifications are delivered in order on a dedicated
+// goroutine so that a slow handler never blocks the connection.
+type Subscription struct {
+	c   *Client
+	key subKey
+	req *api.NotificationRequest
+	q   *queue
+
+	done chan struct{}
+	once sync.Once
+}
+
+// queue delivers notifications to the subscriptions that share it
+// one at a time, in the order iTerm2 sent them.
+type queue struct {
+	fn func(*api.Notification)
+
+	mu    sync.Mutex
+	items []queued
+	live  int
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+type queued struct {
+	s *Subscription
+	n *api.Notification
+}
+
+// subKey identifies what a subscription listens to: the notification
+// type and the scope it was requested for, such as a session id,
+// a variable or an RPC name.
+type subKey struct {
+	typ   api.NotificationType
+	scope string
+}
+
+// Subscribe asks iTerm2 to send the notifications described by req
+// and calls fn for each one of them until the subscription is
+// cancelled. The Subscribe field of req is always set to true.
+// Subscribing more than once to the same notification is allowed:
+// iTerm2 is only told to stop once the last subscriber leaves.
+func (c *Client) Subscribe(ctx context.Context, req *api.NotificationRequest, fn func(*api.Notification)) (*Subscription, error) {
+	subs, err := c.SubscribeMany(ctx, []*api.NotificationRequest{req}, fn)
+	if err != nil {
+		return nil, err
+	}
+	return subs[0], nil
+}
+
+// SubscribeMany is like Subscribe for several kinds of notifications
+// at once. fn is called for all of them from a single goroutine in
+// the order iTerm2 sent them, which separate subscriptions do not
+// guarantee. Each request gets its own Subscription. If any of them
+// fails, those that succeeded are cancelled.
+func (c *Client) SubscribeMany(ctx context.Context, reqs []*api.NotificationRequest, fn func(*api.Notification)) ([]*Subscription, error) {
+	q := &queue{
+		fn:   fn,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	subs := make([]*Subscription, 0, len(reqs))
+	for _, req := range reqs {
+		s, err := c.subscribe(ctx, req, q)
+		if err != nil {
+			for _, s := range subs {
+				s.Unsubscribe(ctx)
+			}
+			return nil, err
+		}
+		subs = append(subs, s)
+	}
+	go q.run()
+	return subs, nil
+}
+
+func (c *Client) subscribe(ctx context.Context, req *api.NotificationRequest, q *queue) (*Subscription, error) {
+	req = proto.Clone(req).(*api.NotificationRequest)
+	req.Subscribe = b(true)
+	s := &Subscription{
+		c:    c,
+		key:  requestKey(req),
+		req:  req,
+		q:    q,
+		done: make(chan struct{}),
+	}
+	q.mu.Lock()
+	q.live++
+	q.mu.Unlock()
+	if err := c.lockSubCalls(ctx); err != nil {
+		s.stop()
+		return nil, err
+	}
+	defer c.unlockSubCalls()
+	c.subMu.Lock()
+	first := len(c.subs[s.key]) == 0
+	c.subs[s.key] = append(c.subs[s.key], s)
+	c.subMu.Unlock()
+	if first {
+		err := c.sendNotificationRequest(ctx, req)
+		if err != nil {
+			c.removeSub(s)
+			s.stop()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// SubscribeChan is like Subscribe but sends every notification to ch.
+// A full channel holds back further notifications for this subscription
+// only; it never blocks the connection.
+func (c *Client) SubscribeChan(ctx context.Context, req *api.NotificationRequest, ch chan<- *api.Notification) (*Subscription, error) {
+	stop := make(chan struct{})
+	s, err := c.Subscribe(ctx, req, func(n *api.Notification) {
+		select {
+		case ch <- n:
+		case <-stop:
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-s.done
+		close(stop)
+	}()
+	return s, nil
+}
+
+// Unsubscribe stops delivering notifications to this subscription and,
+// if it was the last one for its notification, tells iTerm2 to stop
+// sending them. It is safe to call more than once.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		s.q.release()
+		if err = s.c.lockSubCalls(ctx); err != nil {
+			// iTerm2 may keep sending the notification,
+			// which is dropped without subscribers.
+			s.c.removeSub(s)
+			return
+		}
+		defer s.c.unlockSubCalls()
+		if !s.c.removeSub(s) {
+			return
+		}
+		req := proto.Clone(s.req).(*api.NotificationRequest)
+		req.Subscribe = b(false)
+		err = s.c.sendNotificationRequest(ctx, req)
+	})
+	return err
+}
+
+// Done is closed once the subscription has been cancelled.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) push(n *api.Notification) {
+	s.q.mu.Lock()
+	s.q.items = append(s.q.items, queued{s: s, n: n})
+	s.q.mu.Unlock()
+	select {
+	case s.q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stop cancels the subscription locally without
+// telling iTerm2, used when the connection goes away.
+func (s *Subscription) stop() {
+	s.once.Do(func() {
+		close(s.done)
+		s.q.release()
+	})
+}
+
+// release lets go of one of the subscriptions
+// sharing q and stops q once none is left.
+func (q *queue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.live--
+	if q.live == 0 {
+		close(q.done)
+	}
+}
+
+func (q *queue) run() {
+	for {
+		select {
+		case <-q.wake:
+		case <-q.done:
+			return
+		}
+		for {
+			q.mu.Lock()
+			if len(q.items) == 0 {
+				q.mu.Unlock()
+				break
+			}
+			item := q.items[0]
+			q.items[0] = queued{}
+			q.items = q.items[1:]
+			q.mu.Unlock()
+			select {
+			case <-item.s.done:
+				continue
+			default:
+			}
+			q.fn(item.n)
+		}
+	}
+}
+
+// lockSubCalls waits until no other subscription is being
+// registered or dropped with iTerm2, or until ctx is done.
+func (c *Client) lockSubCalls(ctx context.Context) error {
+	select {
+	case c.subCalls <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return ErrClosed
+	}
+}
+
+func (c *Client) unlockSubCalls() {
+	<-c.subCalls
+}
+
+// removeSub drops s from the registry and reports
+// whether it was the last subscriber for its key.
+func (c *Client) removeSub(s *Subscription) bool {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	list := c.subs[s.key]
+	for i, other := range list {
+		if other == s {
+			list = append(list[:i:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(list) == 0 {
+		delete(c.subs, s.key)
+		return true
+	}
+	c.subs[s.key] = list
+	return false
+}
+
+func (c *Client) sendNotificationRequest(ctx context.Context, req *api.NotificationRequest) error {
+	resp, err := c.Notification(ctx, req)
+	if err != nil {
+		return fmt.Errorf("error sending notification request for %s: %w", req.GetNotificationType(), err)
+	}
+	return CheckStatus("NotificationRequest", req.GetSession(), resp.GetStatus())
+}
+
+// dispatch hands a notification to every subscription
+// whose key matches it.
+func (c *Client) dispatch(n *api.Notification) {
+	key, ok := notificationKey(n)
+	if !ok {
+		return
+	}
+	c.subMu.Lock()
+	var targets []*Subscription
+	for k, list := range c.subs {
+		if k.typ == key.typ && (k.scope == key.scope || isWildcard(k.scope)) {
+			targets = append(targets, list...)
+		}
+	}
+	c.subMu.Unlock()
+	for _, s := range targets {
+		s.push(n)
+	}
+}
+
+// isWildcard reports whether a subscription scope
+// matches notifications for any session.
+func isWildcard(scope string) bool {
+	return scope == "" || scope == "all" || scope == "active"
+}
+
+func requestKey(req *api.NotificationRequest) subKey {
+	k := subKey{typ: req.GetNotificationType()}
+	switch k.typ {
+	case api.NotificationType_NOTIFY_ON_KEYSTROKE,
+		api.NotificationType_NOTIFY_ON_SCREEN_UPDATE,
+		api.NotificationType_NOTIFY_ON_PROMPT,
+		api.NotificationType_NOTIFY_ON_LOCATION_CHANGE,
+		api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE,
+		api.NotificationType_KEYSTROKE_FILTER:
+		k.scope = req.GetSession()
+	case api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE:
+		vm := req.GetVariableMonitorRequest()
+		k.scope = variableScope(vm.GetScope(), vm.GetIdentifier(), vm.GetName())
+	case api.NotificationType_NOTIFY_ON_SERVER_ORIGINATED_RPC:
+		k.scope = req.GetRpcRegistrationRequest().GetName()
+	case api.NotificationType_NOTIFY_ON_PROFILE_CHANGE:
+		k.scope = req.GetProfileChangeRequest().GetGuid()
+	}
+	return k
+}
+
+func notificationKey(n *api.Notification) (subKey, bool) {
+	switch {
+	case n.KeystrokeNotification != nil:
+		return subKey{api.NotificationType_NOTIFY_ON_KEYSTROKE, n.GetKeystrokeNotification().GetSession()}, true
+	case n.ScreenUpdateNotification != nil:
+		return subKey{api.NotificationType_NOTIFY_ON_SCREEN_UPDATE, n.GetScreenUpdateNotification().GetSession()}, true
+	case n.PromptNotification != nil:
+		return subKey{api.NotificationType_NOTIFY_ON_PROMPT, n.GetPromptNotification().GetSession()}, true
+	case n.LocationChangeNotification != nil:
+		return subKey{api.NotificationType_NOTIFY_ON_LOCATION_CHANGE, n.GetLocationChangeNotification().GetSession()}, true
+	case n.CustomEscapeSequenceNotification != nil:
+		return subKey{api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE, n.GetCustomEscapeSequenceNotification().GetSession()}, true
+	case n.NewSessionNotification != nil:
+		return subKey{typ: api.NotificationType_NOTIFY_ON_NEW_SESSION}, true
+	case n.TerminateSessionNotification != nil:
+		return subKey{typ: api.NotificationType_NOTIFY_ON_TERMINATE_SESSION}, true
+	case n.LayoutChangedNotification != nil:
+		return subKey{typ: api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE}, true
+	case n.FocusChangedNotification != nil:
+		return subKey{typ: api.NotificationType_NOTIFY_ON_FOCUS_CHANGE}, true
+	case n.ServerOriginatedRpcNotification != nil:
+		return subKey{api.NotificationType_NOTIFY_ON_SERVER_ORIGINATED_RPC, n.GetServerOriginatedRpcNotification().GetRpc().GetName()}, true
+	case n.BroadcastDomainsChanged != nil:
+		return subKey{typ: api.NotificationType_NOTIFY_ON_BROADCAST_CHANGE}, true
+	case n.VariableChangedNotification != nil:
+		vc := n.GetVariableChangedNotification()
+		return subKey{api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE, variableScope(vc.GetScope(), vc.GetIdentifier(), vc.GetName())}, true
+	case n.ProfileChangedNotification != nil:
+		return subKey{api.NotificationType_NOTIFY_ON_PROFILE_CHANGE, n.GetProfileChangedNotification().GetGuid()}, true
+	}
+	return subKey{}, false
+}
+
+func variableScope(scope api.VariableScope, identifier, name string) string {
+	return fmt.Sprintf("%s/%s/%s", scope, identifier, name)
+}
+
+func b(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"marwan.io/iterm2/api"
+)
+
+// LegacyURL is the TCP endpoint that older
+// versions of iTerm2 listen on.
+const LegacyURL = "ws://localhost:1912"
+
+// Options configures how a Client connects to iTerm2.
+// The zero value connects to the local iTerm2 through
+// its private unix socket, which is what New does.
+type Options struct {
+	// Dial opens the underlying connection that the websocket
+	// handshake runs over. When set, SocketPath is ignored.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// SocketPath is the unix socket iTerm2 listens on. Defaults to
+	// ~/Library/Application Support/iTerm2/private/socket.
+	SocketPath string
+
+	// URL is the websocket endpoint to connect to. When set without
+	// Dial, the connection is made over TCP instead of the unix socket,
+	// for example to LegacyURL.
+	URL string
+
+	// HandshakeTimeout bounds the websocket handshake.
+	// Defaults to 45 seconds.
+	HandshakeTimeout time.Duration
+
+	// Header holds extra headers sent with the handshake.
+	// The headers the iTerm2 protocol requires always win.
+	Header http.Header
+
+	// Auth lists the authenticators to try, in order, until
+	// iTerm2 accepts one of their credentials. Defaults to
+	// DefaultAuth.
+	Auth []Authenticator
+
+	// Interceptors wrap every call made by the client,
+	// the first one being the outermost.
+	Interceptors []Interceptor
+
+	// NotificationInterceptors wrap the delivery of every
+	// notification, the first one being the outermost.
+	NotificationInterceptors []NotificationInterceptor
+
+	// Recorder, if set, records every message
+	// sent to and received from iTerm2.
+	Recorder *Recorder
+
+	// OnOrphan, if set, is called with every response that
+	// does not belong to a pending call. Such responses are
+	// dropped either way. It runs on the goroutine that reads
+	// from the connection and therefore must not call Close.
+	OnOrphan func(resp *api.ServerOriginatedMessage, reason OrphanReason)
+
+	// Logger receives connection errors, undecodable messages and
+	// dropped responses. Defaults to discarding them. It is mostly
+	// called from the goroutine that reads from the connection
+	// and therefore must not call Close.
+	Logger Logger
+}
+
+// dialer returns the websocket dialer and the
+// URL to dial according to the options.
+func (o Options) dialer() (*websocket.Dialer, string, error) {
+	d := &websocket.Dialer{
+		HandshakeTimeout: o.HandshakeTimeout,
+		Subprotocols:     []string{"api.iterm2.com"},
+	}
+	if d.HandshakeTimeout == 0 {
+		d.HandshakeTimeout = 45 * time.Second
+	}
+	url := o.URL
+	dial := o.Dial
+	switch {
+	case dial != nil:
+	case url != "":
+		var nd net.Dialer
+		dial = nd.DialContext
+	default:
+		socket := o.SocketPath
+		if socket == "" {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return nil, "", fmt.Errorf("os.UserHomeDir: %w", err)
+			}
+			socket = filepath.Join(homeDir, "/Library/Application Support/iTerm2/private/socket")
+		}
+		dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var nd net.Dialer
+			return nd.DialContext(ctx, "unix", socket)
+		}
+	}
+	d.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &batchConn{Conn: conn}, nil
+	}
+	if url == "" {
+		url = "ws://localhost"
+	}
+	return d, url, nil
+}
+
+// reachable reports whether the endpoint that the options point
+// to accepts connections, without authenticating with it.
+func (o Options) reachable(ctx context.Context) error {
+	d, rawURL, err := o.dialer()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "80")
+	}
+	conn, err := d.NetDialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("iTerm2 is unreachable: %w", err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+
+	"marwan.io/iterm2/api"
+)
+
+// OrphanReason tells why a response had no pending call to go to.
+type OrphanReason int
+
+// The reasons a response can be orphaned.
+const (
+	// OrphanAbandoned responses answer a call that stopped
+	// waiting, typically because its context was done.
+	OrphanAbandoned OrphanReason = iota + 1
+	// OrphanUnknown responses carry an id this client never issued.
+	OrphanUnknown
+)
+
+func (r OrphanReason) String() string {
+	switch r {
+	case OrphanAbandoned:
+		return "abandoned"
+	case OrphanUnknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("OrphanReason(%d)", int(r))
+}
+
+// orphan reports a response that no pending call is waiting for.
+func (c *Client) orphan(resp *api.ServerOriginatedMessage, issued bool) {
+	reason := OrphanUnknown
+	if issued {
+		reason = OrphanAbandoned
+	}
+	c.log().Debug("iterm2: dropped response without a pending call",
+		"id", resp.GetId(),
+		"type", submessageKind(resp),
+		"reason", reason.String(),
+	)
+	if c.opts.OnOrphan != nil {
+		c.opts.OnOrphan(resp, reason)
+	}
+}
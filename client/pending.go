@@ -0,0 +1,105 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// pendingShards is the number of independently locked
+// parts of the pending call table. Must be a power of two.
+const pendingShards = 16
+
+// pending tracks the calls that are waiting for a response.
+// It is sharded by request id so that concurrent callers and
+// the read worker rarely contend for the same lock.
+type pending struct {
+	lastID int64 // accessed atomically
+	closed int32 // accessed atomically
+	shards [pendingShards]pendingShard
+}
+
+type pendingShard struct {
+	mu    sync.Mutex
+	calls map[int64]chan result
+}
+
+func (p *pending) shard(id int64) *pendingShard {
+	return &p.shards[uint64(id)&(pendingShards-1)]
+}
+
+// add reserves a new request id for a call whose
+// response is to be delivered to ch. Ids increase
+// monotonically and are never shared by pending calls.
+func (p *pending) add(ch chan result) (int64, error) {
+	for {
+		id := atomic.AddInt64(&p.lastID, 1)
+		if id <= 0 {
+			// 0 is what notifications carry; start over past it.
+			atomic.CompareAndSwapInt64(&p.lastID, id, 0)
+			continue
+		}
+		s := p.shard(id)
+		s.mu.Lock()
+		// Checked under the shard lock so that
+		// close cannot miss a call added after it.
+		if atomic.LoadInt32(&p.closed) != 0 {
+			s.mu.Unlock()
+			return 0, ErrClosed
+		}
+		if _, dup := s.calls[id]; dup {
+			s.mu.Unlock()
+			continue
+		}
+		if s.calls == nil {
+			s.calls = make(map[int64]chan result)
+		}
+		s.calls[id] = ch
+		s.mu.Unlock()
+		return id, nil
+	}
+}
+
+// take removes the call waiting for id and returns its channel.
+// Whoever takes a call is the only one allowed to send to it.
+func (p *pending) take(id int64) (chan result, bool) {
+	s := p.shard(id)
+	s.mu.Lock()
+	ch, ok := s.calls[id]
+	if ok {
+		delete(s.calls, id)
+	}
+	s.mu.Unlock()
+	return ch, ok
+}
+
+// issued reports whether id was ever handed out by add.
+func (p *pending) issued(id int64) bool {
+	return id > 0 && id <= atomic.LoadInt64(&p.lastID)
+}
+
+// fail releases every pending call with err.
+func (p *pending) fail(err error) {
+	for i := range p.shards {
+		s := &p.shards[i]
+		s.mu.Lock()
+		for id, ch := range s.calls {
+			ch <- result{err: err}
+			delete(s.calls, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// close fails every pending call with ErrClosed
+// and makes any further add fail the same way.
+func (p *pending) close() {
+	atomic.StoreInt32(&p.closed, 1)
+	p.fail(ErrClosed)
+}
+
+// resultPool recycles the channels that calls wait on. A channel
+// goes back only once its call was taken out of the pending table
+// and the result, if any, was received, so it is always empty.
+var resultPool = sync.Pool{
+	New: func() interface{} { return make(chan result, 1) },
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"marwan.io/iterm2/api"
+)
+
+// ErrConnectionLost is returned by calls that were still waiting
+// for a response when the connection to iTerm2 dropped.
+var ErrConnectionLost = errors.New("connection to iTerm2 lost")
+
+// ConnState describes the state of a Client's connection to iTerm2.
+type ConnState int
+
+// The possible connection states. A Client starts out connected,
+// moves to StateReconnecting whenever the connection drops and back
+// to StateConnected once iTerm2 is reachable again. StateClosed is
+// final and only reached by calling Close.
+const (
+	StateConnected ConnState = iota
+	StateReconnecting
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+// State returns the current state of the connection.
+func (c *Client) State() ConnState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	return c.state
+}
+
+// OnStateChange registers fn to be called every time the connection
+// state changes. fn is called synchronously from the goroutine that
+// detected the change and therefore must not block or call Close.
+// The returned func unregisters fn.
+func (c *Client) OnStateChange(fn func(ConnState)) (remove func()) {
+	o := &stateObserver{fn: fn}
+	c.stateMu.Lock()
+	c.observers = append(c.observers, o)
+	c.stateMu.Unlock()
+	return func() {
+		c.stateMu.Lock()
+		defer c.stateMu.Unlock()
+		for i, other := range c.observers {
+			if other == o {
+				c.observers = append(c.observers[:i:i], c.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// stateObserver wraps a func registered with OnStateChange
+// so that it can be told apart from the others.
+type stateObserver struct {
+	fn func(ConnState)
+}
+
+func (c *Client) setState(s ConnState) {
+	c.stateMu.Lock()
+	if c.state == s || c.state == StateClosed {
+		c.stateMu.Unlock()
+		return
+	}
+	c.state = s
+	observers := append([]*stateObserver{}, c.observers...)
+	c.stateMu.Unlock()
+	for _, o := range observers {
+		o.fn(s)
+	}
+}
+
+// reconnect replaces a dead connection with a new one, retrying
+// with exponential backoff. It reports false if the client was
+// closed before a new connection could be established.
+func (c *Client) reconnect(ctx context.Context, cause error) bool {
+	c.setState(StateReconnecting)
+	c.calls.fail(fmt.Errorf("%w: %v", ErrConnectionLost, cause))
+	c.conn().Close()
+	backoff := minBackoff
+	for {
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return false
+		case <-t.C:
+		}
+		// Authenticators may have side effects, such as AppleScript
+		// launching iTerm2, so they only run once iTerm2 is back.
+		var conn *websocket.Conn
+		var header http.Header
+		err := c.opts.reachable(ctx)
+		if err == nil {
+			conn, header, err = dial(ctx, c.appName, c.opts)
+		}
+		if err != nil {
+			backoff *= 2
+			if backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			c.log().Warn("iterm2: reconnect failed", "error", err, "retry_in", backoff)
+			continue
+		}
+		c.connMu.Lock()
+		if ctx.Err() != nil {
+			c.connMu.Unlock()
+			conn.Close()
+			return false
+		}
+		c.c = conn
+		c.header = header
+		c.connMu.Unlock()
+		c.setState(StateConnected)
+		go c.resubscribe(ctx)
+		return true
+	}
+}
+
+// resubscribe registers every active subscription, including
+// server-originated RPCs, with a freshly connected iTerm2.
+func (c *Client) resubscribe(ctx context.Context) {
+	if c.lockSubCalls(ctx) != nil {
+		return
+	}
+	defer c.unlockSubCalls()
+	c.subMu.Lock()
+	reqs := make([]*api.NotificationRequest, 0, len(c.subs))
+	for _, list := range c.subs {
+		if len(list) > 0 {
+			reqs = append(reqs, list[0].req)
+		}
+	}
+	c.subMu.Unlock()
+	for _, req := range reqs {
+		err := c.sendNotificationRequest(ctx, req)
+		if err != nil {
+			c.log().Error("iterm2: could not resubscribe",
+				"type", req.GetNotificationType().String(),
+				"error", err,
+			)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+	"marwan.io/iterm2/iterm2test"
+)
+
+// waitState returns a channel that receives every
+// state the client moves to from now on.
+func waitState(c *client.Client) <-chan client.ConnState {
+	states := make(chan client.ConnState, 10)
+	c.OnStateChange(func(s client.ConnState) {
+		select {
+		case states <- s:
+		default:
+		}
+	})
+	return states
+}
+
+func awaitState(t *testing.T, states <-chan client.ConnState, want client.ConnState) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case s := <-states:
+			if s == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %v", want)
+		}
+	}
+}
+
+func TestCallWhileReconnecting(t *testing.T) {
+	srv := iterm2test.NewServer()
+	c, err := client.NewWithOptions("test", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	states := waitState(c)
+	srv.Close()
+	awaitState(t, states, client.StateReconnecting)
+
+	_, err = c.Call(variableRequest("during reconnect"))
+	if !errors.Is(err, client.ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost but got %v", err)
+	}
+}
+
+func TestResubscribeAfterReconnect(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	c, err := client.NewWithOptions("test", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan *api.Notification, 10)
+	_, err = c.Subscribe(context.Background(), &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_NEW_SESSION.Enum(),
+	}, func(n *api.Notification) { got <- n })
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := waitState(c)
+	srv.DropConnections()
+	awaitState(t, states, client.StateConnected)
+
+	// Subscriptions are registered again in the background.
+	id := "after reconnect"
+	n := &api.Notification{NewSessionNotification: &api.NewSessionNotification{SessionId: &id}}
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Notify(n) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the subscription was not registered again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case n := <-got:
+		if n.GetNewSessionNotification().GetSessionId() != id {
+			t.Fatalf("got unexpected notification %v", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the notification")
+	}
+}
+
+func TestCloseWhileReconnecting(t *testing.T) {
+	srv := iterm2test.NewServer()
+	c, err := client.NewWithOptions("test", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := waitState(c)
+	srv.Close()
+	awaitState(t, states, client.StateReconnecting)
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("expected closing a lost connection to succeed but got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"marwan.io/iterm2/api"
+)
+
+// recordingMagic starts every recording so that
+// readers can tell it apart from other files.
+const recordingMagic = "ITERM2REC1\n"
+
+// Direction tells whether a recorded message was sent to or received from iTerm2.
+type Direction byte
+
+// The directions a message can travel in.
+const (
+	Sent     Direction = 1
+	Received Direction = 2
+)
+
+func (d Direction) String() string {
+	switch d {
+	case Sent:
+		return "sent"
+	case Received:
+		return "received"
+	}
+	return fmt.Sprintf("Direction(%d)", byte(d))
+}
+
+// Record is a single message that went over the wire.
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	// Message is the encoded protobuf: an api.ClientOriginatedMessage
+	// when sent and an api.ServerOriginatedMessage when received.
+	Message []byte
+}
+
+// Decode unmarshals the message of the record.
+func (r Record) Decode() (proto.Message, error) {
+	var m proto.Message = &api.ServerOriginatedMessage{}
+	if r.Direction == Sent {
+		m = &api.ClientOriginatedMessage{}
+	}
+	if err := proto.Unmarshal(r.Message, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Recorder writes every message a Client sends and receives. The
+// binary recording is a magic header followed by records, each made
+// of a direction byte, a big-endian unix nanosecond timestamp, a
+// uvarint length and the encoded protobuf. It can be read back with
+// ReadRecording.
+type Recorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	view    io.Writer
+	started bool
+	err     error
+}
+
+// NewRecorder returns a Recorder that writes the binary recording
+// to w and, if view is not nil, a human readable protojson line
+// per message to view.
+func NewRecorder(w, view io.Writer) *Recorder {
+	return &Recorder{w: w, view: view}
+}
+
+// Err returns the first error the recorder ran into. Once
+// it fails, a recorder stops writing.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) record(dir Direction, msg []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return
+	}
+	now := time.Now()
+	r.err = r.writeBinary(now, dir, msg)
+	if r.err == nil && r.view != nil {
+		r.err = r.writeView(now, dir, msg)
+	}
+}
+
+func (r *Recorder) writeBinary(t time.Time, dir Direction, msg []byte) error {
+	if !r.started {
+		if _, err := io.WriteString(r.w, recordingMagic); err != nil {
+			return err
+		}
+		r.started = true
+	}
+	buf := make([]byte, 1+8+binary.MaxVarintLen64, 1+8+binary.MaxVarintLen64+len(msg))
+	buf[0] = byte(dir)
+	binary.BigEndian.PutUint64(buf[1:9], uint64(t.UnixNano()))
+	n := binary.PutUvarint(buf[9:], uint64(len(msg)))
+	buf = append(buf[:9+n], msg...)
+	_, err := r.w.Write(buf)
+	return err
+}
+
+func (r *Recorder) writeView(t time.Time, dir Direction, msg []byte) error {
+	m, err := Record{Direction: dir, Message: msg}.Decode()
+	if err != nil {
+		return err
+	}
+	body, err := protojson.Marshal(m)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(struct {
+		Time      time.Time       `json:"time"`
+		Direction string          `json:"direction"`
+		Message   json.RawMessage `json:"message"`
+	}{t, dir.String(), body})
+	if err != nil {
+		return err
+	}
+	_, err = r.view.Write(append(line, '\n'))
+	return err
+}
+
+// ReadRecording reads back every record written by a Recorder.
+func ReadRecording(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(recordingMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading recording header: %w", err)
+	}
+	if string(magic) != recordingMagic {
+		return nil, errors.New("not an iTerm2 recording")
+	}
+	var records []Record
+	for {
+		dir, err := br.ReadByte()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var ts [8]byte
+		if _, err := io.ReadFull(br, ts[:]); err != nil {
+			return nil, fmt.Errorf("error reading record %d: %w", len(records), err)
+		}
+		size, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, fmt.Errorf("error reading record %d: %w", len(records), err)
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(br, msg); err != nil {
+			return nil, fmt.Errorf("error reading record %d: %w", len(records), err)
+		}
+		records = append(records, Record{
+			Time:      time.Unix(0, int64(binary.BigEndian.Uint64(ts[:]))),
+			Direction: Direction(dir),
+			Message:   msg,
+		})
+	}
+}
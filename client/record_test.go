@@ -0,0 +1,113 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+	"marwan.io/iterm2/iterm2test"
+)
+
+func newSessionNote(id string) *api.Notification {
+	return &api.Notification{NewSessionNotification: &api.NewSessionNotification{SessionId: &id}}
+}
+
+// subscribe registers for new sessions and returns
+// the ids of the sessions it gets notified about.
+func subscribe(t *testing.T, c *client.Client) <-chan string {
+	t.Helper()
+	got := make(chan string, 10)
+	_, err := c.Subscribe(context.Background(), &api.NotificationRequest{
+		NotificationType: api.NotificationType_NOTIFY_ON_NEW_SESSION.Enum(),
+	}, func(n *api.Notification) { got <- n.GetNewSessionNotification().GetSessionId() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func expectNotes(t *testing.T, got <-chan string, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		select {
+		case g := <-got:
+			if g != id {
+				t.Fatalf("expected session %q but got %q", id, g)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for session %q", id)
+		}
+	}
+}
+
+func expectVariable(t *testing.T, c *client.Client, name string) {
+	t.Helper()
+	resp, err := c.Call(variableRequest(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values := resp.GetVariableResponse().GetValues(); len(values) != 1 || values[0] != name {
+		t.Fatalf("expected the response to %q but got %v", name, values)
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	srv.Handle(echo)
+	var rec bytes.Buffer
+	opts := srv.Options()
+	opts.Recorder = client.NewRecorder(&rec, nil)
+	c, err := client.NewWithOptions("test", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := subscribe(t, c)
+	expectVariable(t, c, "first")
+	for i := 0; i < 5; i++ {
+		srv.Notify(newSessionNote(strconv.Itoa(i)))
+	}
+	expectNotes(t, got, "0", "1", "2", "3", "4")
+	if _, err := c.ListSessions(context.Background(), &api.ListSessionsRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	expectVariable(t, c, "second")
+	c.Close()
+	if err := opts.Recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := client.ReadRecording(&rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := iterm2test.NewReplay(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replay.Close()
+	c, err = client.NewWithOptions("test", replay.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got = subscribe(t, c)
+	// Requests are matched by kind rather than position, so
+	// they get new ids that the responses are re-mapped to.
+	if _, err := c.ListSessions(context.Background(), &api.ListSessionsRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	expectVariable(t, c, "first")
+	expectNotes(t, got, "0", "1", "2", "3", "4")
+	expectVariable(t, c, "second")
+	if err := replay.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := replay.Remaining(); n != 0 {
+		t.Fatalf("%d recorded requests were not replayed", n)
+	}
+}
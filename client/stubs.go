@@ -0,0 +1,558 @@
+// Code generated by genstubs. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+
+	"marwan.io/iterm2/api"
+)
+
+// GetBuffer sends a GetBufferRequest and returns the
+// GetBufferResponse that iTerm2 answers it with.
+func (c *Client) GetBuffer(ctx context.Context, req *api.GetBufferRequest) (*api.GetBufferResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_GetBufferRequest{GetBufferRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_GetBufferResponse)
+	if !ok {
+		return nil, unexpectedResponse("GetBufferRequest", resp)
+	}
+	return sub.GetBufferResponse, nil
+}
+
+// GetPrompt sends a GetPromptRequest and returns the
+// GetPromptResponse that iTerm2 answers it with.
+func (c *Client) GetPrompt(ctx context.Context, req *api.GetPromptRequest) (*api.GetPromptResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_GetPromptRequest{GetPromptRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_GetPromptResponse)
+	if !ok {
+		return nil, unexpectedResponse("GetPromptRequest", resp)
+	}
+	return sub.GetPromptResponse, nil
+}
+
+// Transaction sends a TransactionRequest and returns the
+// TransactionResponse that iTerm2 answers it with.
+func (c *Client) Transaction(ctx context.Context, req *api.TransactionRequest) (*api.TransactionResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_TransactionRequest{TransactionRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_TransactionResponse)
+	if !ok {
+		return nil, unexpectedResponse("TransactionRequest", resp)
+	}
+	return sub.TransactionResponse, nil
+}
+
+// Notification sends a NotificationRequest and returns the
+// NotificationResponse that iTerm2 answers it with.
+// It bypasses the bookkeeping of Subscribe, which most callers want instead.
+func (c *Client) Notification(ctx context.Context, req *api.NotificationRequest) (*api.NotificationResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_NotificationRequest{NotificationRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_NotificationResponse)
+	if !ok {
+		return nil, unexpectedResponse("NotificationRequest", resp)
+	}
+	return sub.NotificationResponse, nil
+}
+
+// RegisterTool sends a RegisterToolRequest and returns the
+// RegisterToolResponse that iTerm2 answers it with.
+func (c *Client) RegisterTool(ctx context.Context, req *api.RegisterToolRequest) (*api.RegisterToolResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_RegisterToolRequest{RegisterToolRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_RegisterToolResponse)
+	if !ok {
+		return nil, unexpectedResponse("RegisterToolRequest", resp)
+	}
+	return sub.RegisterToolResponse, nil
+}
+
+// SetProfileProperty sends a SetProfilePropertyRequest and returns the
+// SetProfilePropertyResponse that iTerm2 answers it with.
+func (c *Client) SetProfileProperty(ctx context.Context, req *api.SetProfilePropertyRequest) (*api.SetProfilePropertyResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SetProfilePropertyRequest{SetProfilePropertyRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SetProfilePropertyResponse)
+	if !ok {
+		return nil, unexpectedResponse("SetProfilePropertyRequest", resp)
+	}
+	return sub.SetProfilePropertyResponse, nil
+}
+
+// ListSessions sends a ListSessionsRequest and returns the
+// ListSessionsResponse that iTerm2 answers it with.
+func (c *Client) ListSessions(ctx context.Context, req *api.ListSessionsRequest) (*api.ListSessionsResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{ListSessionsRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_ListSessionsResponse)
+	if !ok {
+		return nil, unexpectedResponse("ListSessionsRequest", resp)
+	}
+	return sub.ListSessionsResponse, nil
+}
+
+// SendText sends a SendTextRequest and returns the
+// SendTextResponse that iTerm2 answers it with.
+func (c *Client) SendText(ctx context.Context, req *api.SendTextRequest) (*api.SendTextResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SendTextRequest{SendTextRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SendTextResponse)
+	if !ok {
+		return nil, unexpectedResponse("SendTextRequest", resp)
+	}
+	return sub.SendTextResponse, nil
+}
+
+// CreateTab sends a CreateTabRequest and returns the
+// CreateTabResponse that iTerm2 answers it with.
+func (c *Client) CreateTab(ctx context.Context, req *api.CreateTabRequest) (*api.CreateTabResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{CreateTabRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_CreateTabResponse)
+	if !ok {
+		return nil, unexpectedResponse("CreateTabRequest", resp)
+	}
+	return sub.CreateTabResponse, nil
+}
+
+// SplitPane sends a SplitPaneRequest and returns the
+// SplitPaneResponse that iTerm2 answers it with.
+func (c *Client) SplitPane(ctx context.Context, req *api.SplitPaneRequest) (*api.SplitPaneResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SplitPaneRequest{SplitPaneRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SplitPaneResponse)
+	if !ok {
+		return nil, unexpectedResponse("SplitPaneRequest", resp)
+	}
+	return sub.SplitPaneResponse, nil
+}
+
+// GetProfileProperty sends a GetProfilePropertyRequest and returns the
+// GetProfilePropertyResponse that iTerm2 answers it with.
+func (c *Client) GetProfileProperty(ctx context.Context, req *api.GetProfilePropertyRequest) (*api.GetProfilePropertyResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_GetProfilePropertyRequest{GetProfilePropertyRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_GetProfilePropertyResponse)
+	if !ok {
+		return nil, unexpectedResponse("GetProfilePropertyRequest", resp)
+	}
+	return sub.GetProfilePropertyResponse, nil
+}
+
+// SetProperty sends a SetPropertyRequest and returns the
+// SetPropertyResponse that iTerm2 answers it with.
+func (c *Client) SetProperty(ctx context.Context, req *api.SetPropertyRequest) (*api.SetPropertyResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SetPropertyRequest{SetPropertyRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SetPropertyResponse)
+	if !ok {
+		return nil, unexpectedResponse("SetPropertyRequest", resp)
+	}
+	return sub.SetPropertyResponse, nil
+}
+
+// GetProperty sends a GetPropertyRequest and returns the
+// GetPropertyResponse that iTerm2 answers it with.
+func (c *Client) GetProperty(ctx context.Context, req *api.GetPropertyRequest) (*api.GetPropertyResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_GetPropertyRequest{GetPropertyRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_GetPropertyResponse)
+	if !ok {
+		return nil, unexpectedResponse("GetPropertyRequest", resp)
+	}
+	return sub.GetPropertyResponse, nil
+}
+
+// Inject sends an InjectRequest and returns the
+// InjectResponse that iTerm2 answers it with.
+func (c *Client) Inject(ctx context.Context, req *api.InjectRequest) (*api.InjectResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_InjectRequest{InjectRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_InjectResponse)
+	if !ok {
+		return nil, unexpectedResponse("InjectRequest", resp)
+	}
+	return sub.InjectResponse, nil
+}
+
+// Activate sends an ActivateRequest and returns the
+// ActivateResponse that iTerm2 answers it with.
+func (c *Client) Activate(ctx context.Context, req *api.ActivateRequest) (*api.ActivateResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ActivateRequest{ActivateRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_ActivateResponse)
+	if !ok {
+		return nil, unexpectedResponse("ActivateRequest", resp)
+	}
+	return sub.ActivateResponse, nil
+}
+
+// Variable sends a VariableRequest and returns the
+// VariableResponse that iTerm2 answers it with.
+func (c *Client) Variable(ctx context.Context, req *api.VariableRequest) (*api.VariableResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_VariableRequest{VariableRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_VariableResponse)
+	if !ok {
+		return nil, unexpectedResponse("VariableRequest", resp)
+	}
+	return sub.VariableResponse, nil
+}
+
+// SavedArrangement sends a SavedArrangementRequest and returns the
+// SavedArrangementResponse that iTerm2 answers it with.
+func (c *Client) SavedArrangement(ctx context.Context, req *api.SavedArrangementRequest) (*api.SavedArrangementResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SavedArrangementRequest{SavedArrangementRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SavedArrangementResponse)
+	if !ok {
+		return nil, unexpectedResponse("SavedArrangementRequest", resp)
+	}
+	return sub.SavedArrangementResponse, nil
+}
+
+// Focus sends a FocusRequest and returns the
+// FocusResponse that iTerm2 answers it with.
+func (c *Client) Focus(ctx context.Context, req *api.FocusRequest) (*api.FocusResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_FocusRequest{FocusRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_FocusResponse)
+	if !ok {
+		return nil, unexpectedResponse("FocusRequest", resp)
+	}
+	return sub.FocusResponse, nil
+}
+
+// ListProfiles sends a ListProfilesRequest and returns the
+// ListProfilesResponse that iTerm2 answers it with.
+func (c *Client) ListProfiles(ctx context.Context, req *api.ListProfilesRequest) (*api.ListProfilesResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListProfilesRequest{ListProfilesRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_ListProfilesResponse)
+	if !ok {
+		return nil, unexpectedResponse("ListProfilesRequest", resp)
+	}
+	return sub.ListProfilesResponse, nil
+}
+
+// ServerOriginatedRPCResult sends a ServerOriginatedRPCResultRequest and returns the
+// ServerOriginatedRPCResultResponse that iTerm2 answers it with.
+func (c *Client) ServerOriginatedRPCResult(ctx context.Context, req *api.ServerOriginatedRPCResultRequest) (*api.ServerOriginatedRPCResultResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ServerOriginatedRpcResultRequest{ServerOriginatedRpcResultRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_ServerOriginatedRpcResultResponse)
+	if !ok {
+		return nil, unexpectedResponse("ServerOriginatedRPCResultRequest", resp)
+	}
+	return sub.ServerOriginatedRpcResultResponse, nil
+}
+
+// RestartSession sends a RestartSessionRequest and returns the
+// RestartSessionResponse that iTerm2 answers it with.
+func (c *Client) RestartSession(ctx context.Context, req *api.RestartSessionRequest) (*api.RestartSessionResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_RestartSessionRequest{RestartSessionRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_RestartSessionResponse)
+	if !ok {
+		return nil, unexpectedResponse("RestartSessionRequest", resp)
+	}
+	return sub.RestartSessionResponse, nil
+}
+
+// MenuItem sends a MenuItemRequest and returns the
+// MenuItemResponse that iTerm2 answers it with.
+func (c *Client) MenuItem(ctx context.Context, req *api.MenuItemRequest) (*api.MenuItemResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_MenuItemRequest{MenuItemRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_MenuItemResponse)
+	if !ok {
+		return nil, unexpectedResponse("MenuItemRequest", resp)
+	}
+	return sub.MenuItemResponse, nil
+}
+
+// SetTabLayout sends a SetTabLayoutRequest and returns the
+// SetTabLayoutResponse that iTerm2 answers it with.
+func (c *Client) SetTabLayout(ctx context.Context, req *api.SetTabLayoutRequest) (*api.SetTabLayoutResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SetTabLayoutRequest{SetTabLayoutRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SetTabLayoutResponse)
+	if !ok {
+		return nil, unexpectedResponse("SetTabLayoutRequest", resp)
+	}
+	return sub.SetTabLayoutResponse, nil
+}
+
+// GetBroadcastDomains sends a GetBroadcastDomainsRequest and returns the
+// GetBroadcastDomainsResponse that iTerm2 answers it with.
+func (c *Client) GetBroadcastDomains(ctx context.Context, req *api.GetBroadcastDomainsRequest) (*api.GetBroadcastDomainsResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_GetBroadcastDomainsRequest{GetBroadcastDomainsRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_GetBroadcastDomainsResponse)
+	if !ok {
+		return nil, unexpectedResponse("GetBroadcastDomainsRequest", resp)
+	}
+	return sub.GetBroadcastDomainsResponse, nil
+}
+
+// Tmux sends a TmuxRequest and returns the
+// TmuxResponse that iTerm2 answers it with.
+func (c *Client) Tmux(ctx context.Context, req *api.TmuxRequest) (*api.TmuxResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_TmuxRequest{TmuxRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_TmuxResponse)
+	if !ok {
+		return nil, unexpectedResponse("TmuxRequest", resp)
+	}
+	return sub.TmuxResponse, nil
+}
+
+// ReorderTabs sends a ReorderTabsRequest and returns the
+// ReorderTabsResponse that iTerm2 answers it with.
+func (c *Client) ReorderTabs(ctx context.Context, req *api.ReorderTabsRequest) (*api.ReorderTabsResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ReorderTabsRequest{ReorderTabsRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_ReorderTabsResponse)
+	if !ok {
+		return nil, unexpectedResponse("ReorderTabsRequest", resp)
+	}
+	return sub.ReorderTabsResponse, nil
+}
+
+// Preferences sends a PreferencesRequest and returns the
+// PreferencesResponse that iTerm2 answers it with.
+func (c *Client) Preferences(ctx context.Context, req *api.PreferencesRequest) (*api.PreferencesResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_PreferencesRequest{PreferencesRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_PreferencesResponse)
+	if !ok {
+		return nil, unexpectedResponse("PreferencesRequest", resp)
+	}
+	return sub.PreferencesResponse, nil
+}
+
+// ColorPreset sends a ColorPresetRequest and returns the
+// ColorPresetResponse that iTerm2 answers it with.
+func (c *Client) ColorPreset(ctx context.Context, req *api.ColorPresetRequest) (*api.ColorPresetResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ColorPresetRequest{ColorPresetRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_ColorPresetResponse)
+	if !ok {
+		return nil, unexpectedResponse("ColorPresetRequest", resp)
+	}
+	return sub.ColorPresetResponse, nil
+}
+
+// Selection sends a SelectionRequest and returns the
+// SelectionResponse that iTerm2 answers it with.
+func (c *Client) Selection(ctx context.Context, req *api.SelectionRequest) (*api.SelectionResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SelectionRequest{SelectionRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SelectionResponse)
+	if !ok {
+		return nil, unexpectedResponse("SelectionRequest", resp)
+	}
+	return sub.SelectionResponse, nil
+}
+
+// StatusBarComponent sends a StatusBarComponentRequest and returns the
+// StatusBarComponentResponse that iTerm2 answers it with.
+func (c *Client) StatusBarComponent(ctx context.Context, req *api.StatusBarComponentRequest) (*api.StatusBarComponentResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_StatusBarComponentRequest{StatusBarComponentRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_StatusBarComponentResponse)
+	if !ok {
+		return nil, unexpectedResponse("StatusBarComponentRequest", resp)
+	}
+	return sub.StatusBarComponentResponse, nil
+}
+
+// SetBroadcastDomains sends a SetBroadcastDomainsRequest and returns the
+// SetBroadcastDomainsResponse that iTerm2 answers it with.
+func (c *Client) SetBroadcastDomains(ctx context.Context, req *api.SetBroadcastDomainsRequest) (*api.SetBroadcastDomainsResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_SetBroadcastDomainsRequest{SetBroadcastDomainsRequest: req},
+	})
+	if err != nil {
+		return nil, err
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_SetBroadcastDomainsResponse)
+	if !ok {
+		return nil, unexpectedResponse("SetBroadcastDomainsRequest", resp)
+	}
+	return sub.SetBroadcastDomainsResponse, nil
+}
+
+// CloseTargets sends a CloseRequest and returns the
+// CloseResponse that iTerm2 answers it with.
+// It is named so as not to clash with Client.Close.
+// Older versions of iTerm2 make it fail with ErrUnsupported.
+func (c *Client) CloseTargets(ctx context.Context, req *api.CloseRequest) (*api.CloseResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_CloseRequest{CloseRequest: req},
+	})
+	if err != nil {
+		return nil, unsupported("CloseRequest", err)
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_CloseResponse)
+	if !ok {
+		return nil, unexpectedResponse("CloseRequest", resp)
+	}
+	return sub.CloseResponse, nil
+}
+
+// InvokeFunction sends an InvokeFunctionRequest and returns the
+// InvokeFunctionResponse that iTerm2 answers it with.
+// Older versions of iTerm2 make it fail with ErrUnsupported.
+func (c *Client) InvokeFunction(ctx context.Context, req *api.InvokeFunctionRequest) (*api.InvokeFunctionResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{InvokeFunctionRequest: req},
+	})
+	if err != nil {
+		return nil, unsupported("InvokeFunctionRequest", err)
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_InvokeFunctionResponse)
+	if !ok {
+		return nil, unexpectedResponse("InvokeFunctionRequest", resp)
+	}
+	return sub.InvokeFunctionResponse, nil
+}
+
+// ListPrompts sends a ListPromptsRequest and returns the
+// ListPromptsResponse that iTerm2 answers it with.
+// Older versions of iTerm2 make it fail with ErrUnsupported.
+func (c *Client) ListPrompts(ctx context.Context, req *api.ListPromptsRequest) (*api.ListPromptsResponse, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_ListPromptsRequest{ListPromptsRequest: req},
+	})
+	if err != nil {
+		return nil, unsupported("ListPromptsRequest", err)
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_ListPromptsResponse)
+	if !ok {
+		return nil, unexpectedResponse("ListPromptsRequest", resp)
+	}
+	return sub.ListPromptsResponse, nil
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"net"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+	"marwan.io/iterm2/api"
+)
+
+// maxPooledBuffer is the capacity past which a marshal buffer
+// is dropped instead of pooled, so that one huge request does
+// not pin its memory forever.
+const maxPooledBuffer = 64 << 10
+
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// marshal encodes req into a pooled buffer. The
+// buffer must be given back with releaseBuffer.
+func marshal(req *api.ClientOriginatedMessage) (*[]byte, error) {
+	buf := bufPool.Get().(*[]byte)
+	b, err := proto.MarshalOptions{}.MarshalAppend((*buf)[:0], req)
+	if err != nil {
+		releaseBuffer(buf)
+		return nil, err
+	}
+	*buf = b
+	return buf, nil
+}
+
+func releaseBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledBuffer {
+		return
+	}
+	bufPool.Put(buf)
+}
+
+// writeReq is an encoded request waiting to be written.
+// If writing it fails, the error goes to the pending call.
+type writeReq struct {
+	id  int64
+	buf *[]byte
+}
+
+// writeQueue hands requests over to the write worker. Callers never
+// block on it: they append and move on, and the worker drains every
+// queued request at once so that they go out in a single write.
+type writeQueue struct {
+	mu    sync.Mutex
+	reqs  []writeReq
+	spare []writeReq
+	wake  chan struct{}
+}
+
+func newWriteQueue() *writeQueue {
+	return &writeQueue{wake: make(chan struct{}, 1)}
+}
+
+func (q *writeQueue) push(r writeReq) {
+	q.mu.Lock()
+	q.reqs = append(q.reqs, r)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drain returns every queued request. The returned
+// slice must be handed back with recycle once written.
+func (q *writeQueue) drain() []writeReq {
+	q.mu.Lock()
+	reqs := q.reqs
+	q.reqs = q.spare[:0]
+	q.spare = nil
+	q.mu.Unlock()
+	return reqs
+}
+
+func (q *writeQueue) recycle(reqs []writeReq) {
+	for i := range reqs {
+		reqs[i] = writeReq{}
+	}
+	q.mu.Lock()
+	q.spare = reqs[:0]
+	q.mu.Unlock()
+}
+
+// batchConn buffers the frames that the websocket connection writes
+// between begin and flush so that a batch of requests reaches the
+// socket in one system call. Outside of a batch, writes, such as the
+// handshake and control frames, go straight through.
+type batchConn struct {
+	net.Conn
+
+	mu       sync.Mutex
+	batching bool
+	buf      []byte
+}
+
+func (b *batchConn) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.batching {
+		b.buf = append(b.buf, p...)
+		return len(p), nil
+	}
+	return b.Conn.Write(p)
+}
+
+func (b *batchConn) begin() {
+	b.mu.Lock()
+	b.batching = true
+	b.mu.Unlock()
+}
+
+func (b *batchConn) flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.batching = false
+	if len(b.buf) == 0 {
+		return nil
+	}
+	_, err := b.Conn.Write(b.buf)
+	if cap(b.buf) > maxPooledBuffer {
+		b.buf = nil
+	} else {
+		b.buf = b.buf[:0]
+	}
+	return err
+}
+
+// writeBatch writes reqs to ws and reports the error, if any,
+// that kept them from reaching iTerm2.
+func (c *Client) writeBatch(ws *websocket.Conn, reqs []writeReq) error {
+	bc, _ := ws.UnderlyingConn().(*batchConn)
+	if bc != nil && len(reqs) > 1 {
+		bc.begin()
+	}
+	for _, r := range reqs {
+		// Recorded ahead of the write so that the
+		// response can never be recorded before it.
+		if c.opts.Recorder != nil {
+			c.opts.Recorder.record(Sent, *r.buf)
+		}
+		if err := ws.WriteMessage(websocket.BinaryMessage, *r.buf); err != nil {
+			if bc != nil {
+				bc.flush()
+			}
+			return err
+		}
+	}
+	if bc != nil {
+		return bc.flush()
+	}
+	return nil
+}
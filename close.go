@@ -0,0 +1,142 @@
+package iterm2
+
+import (
+	"context"
+	"fmt"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// Closable is a Window, Tab or Session.
+type Closable interface {
+	Close(force bool) error
+	CloseContext(ctx context.Context, force bool) error
+}
+
+// CloseResult is the outcome of closing one target.
+type CloseResult struct {
+	Target Closable
+	// Err is nil if the target was closed. Otherwise it is a
+	// *client.StatusError matching client.ErrNotFound or
+	// client.ErrUserDeclined with errors.Is.
+	Err error
+}
+
+// closeKind is the kind of target a CloseRequest addresses.
+type closeKind int
+
+const (
+	closeWindows closeKind = iota
+	closeTabs
+	closeSessions
+)
+
+func (w *window) Close(force bool) error {
+	return w.CloseContext(context.Background(), force)
+}
+
+// CloseContext closes the window. Unless force is set, iTerm2
+// may ask the user first and fail with client.ErrUserDeclined.
+func (w *window) CloseContext(ctx context.Context, force bool) error {
+	return closeOne(ctx, w.c, closeWindows, w.id, force)
+}
+
+func (t *tab) Close(force bool) error {
+	return t.CloseContext(context.Background(), force)
+}
+
+// CloseContext closes the tab. Unless force is set, iTerm2
+// may ask the user first and fail with client.ErrUserDeclined.
+func (t *tab) CloseContext(ctx context.Context, force bool) error {
+	return closeOne(ctx, t.c, closeTabs, t.id, force)
+}
+
+func (s *session) Close(force bool) error {
+	return s.CloseContext(context.Background(), force)
+}
+
+// CloseContext closes the session. Unless force is set, iTerm2
+// may ask the user first and fail with client.ErrUserDeclined.
+func (s *session) CloseContext(ctx context.Context, force bool) error {
+	return closeOne(ctx, s.c, closeSessions, s.id, force)
+}
+
+func closeOne(ctx context.Context, c *client.Client, kind closeKind, id string, force bool) error {
+	statuses, err := closeIDs(ctx, c, kind, []string{id}, force)
+	if err != nil {
+		return err
+	}
+	return client.CheckStatus("CloseRequest", id, statuses[0])
+}
+
+// closeIDs closes targets of the same kind in a single request
+// and returns the status of each of them, in order.
+func closeIDs(ctx context.Context, c *client.Client, kind closeKind, ids []string, force bool) ([]api.CloseResponse_Status, error) {
+	req := &api.CloseRequest{Force: &force}
+	switch kind {
+	case closeWindows:
+		req.Target = &api.CloseRequest_Windows{Windows: &api.CloseRequest_CloseWindows{WindowIds: ids}}
+	case closeTabs:
+		req.Target = &api.CloseRequest_Tabs{Tabs: &api.CloseRequest_CloseTabs{TabIds: ids}}
+	case closeSessions:
+		req.Target = &api.CloseRequest_Sessions{Sessions: &api.CloseRequest_CloseSessions{SessionIds: ids}}
+	}
+	resp, err := c.CloseTargets(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not close %v: %w", ids, err)
+	}
+	statuses := resp.GetStatuses()
+	if len(statuses) != len(ids) {
+		return nil, fmt.Errorf("expected %d close statuses but got %d", len(ids), len(statuses))
+	}
+	return statuses, nil
+}
+
+func (a *app) CloseTargets(force bool, targets ...Closable) ([]CloseResult, error) {
+	return a.CloseTargetsContext(context.Background(), force, targets...)
+}
+
+// CloseTargetsContext closes windows, tabs and sessions with one
+// request per kind of target and returns a result for each target,
+// in order. When a request fails as a whole, the targets it was for
+// get its error, the other kinds are still closed and the first such
+// error is also returned.
+func (a *app) CloseTargetsContext(ctx context.Context, force bool, targets ...Closable) ([]CloseResult, error) {
+	var ids [3][]string
+	var pos [3][]int
+	for i, t := range targets {
+		var kind closeKind
+		var id string
+		switch t := t.(type) {
+		case *window:
+			kind, id = closeWindows, t.id
+		case *tab:
+			kind, id = closeTabs, t.id
+		case *session:
+			kind, id = closeSessions, t.id
+		default:
+			return nil, fmt.Errorf("cannot close %T", t)
+		}
+		ids[kind] = append(ids[kind], id)
+		pos[kind] = append(pos[kind], i)
+	}
+	results := make([]CloseResult, len(targets))
+	var firstErr error
+	for kind := range ids {
+		if len(ids[kind]) == 0 {
+			continue
+		}
+		statuses, err := closeIDs(ctx, a.c, closeKind(kind), ids[kind], force)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		for j, i := range pos[kind] {
+			results[i] = CloseResult{Target: targets[i], Err: err}
+			if err == nil {
+				results[i].Err = client.CheckStatus("CloseRequest", ids[kind][j], statuses[j])
+			}
+		}
+	}
+	return results, firstErr
+}
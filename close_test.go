@@ -0,0 +1,55 @@
+package iterm2_test
+
+import (
+	"errors"
+	"testing"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+func TestCloseTargetsPartialFailure(t *testing.T) {
+	app, srv := newApp(t)
+	w, err := app.CreateWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := w.CreateTab()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tabs, err := w.ListTabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := tabs[0].ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetCloseRequest().GetTabs() == nil {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_Error{Error: "cannot close tabs"},
+		}
+	})
+
+	results, err := app.CloseTargets(true, sessions[0], tab)
+	var se *client.ServerError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected a server error but got %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results but got %d", len(results))
+	}
+	if results[0].Target != sessions[0] || results[0].Err != nil {
+		t.Fatalf("expected the session to be closed but got %+v", results[0])
+	}
+	if results[1].Target != tab || !errors.As(results[1].Err, &se) {
+		t.Fatalf("expected the tab to fail with a server error but got %+v", results[1])
+	}
+	if _, err := app.SessionByID(sessions[0].GetSessionID()); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("expected the session to be gone but got %v", err)
+	}
+}
@@ -0,0 +1,12 @@
+package iterm2
+
+import "time"
+
+// SetCleanupTimeout lets tests shorten how long cleaning up,
+// such as ending a transaction, may take and returns a func
+// that restores the previous value.
+func SetCleanupTimeout(d time.Duration) (restore func()) {
+	old := cleanupTimeout
+	cleanupTimeout = d
+	return func() { cleanupTimeout = old }
+}
@@ -0,0 +1,156 @@
+// Command genstubs generates a typed Client method for every
+// request that api.proto defines. It pairs the submessages of
+// ClientOriginatedMessage and ServerOriginatedMessage by field
+// number, which is how iTerm2 matches a request to its response.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"marwan.io/iterm2/api"
+)
+
+// renames avoids clashes with the hand
+// written methods of client.Client.
+var renames = map[string]string{
+	"Close": "CloseTargets",
+}
+
+// notes are appended to the doc comment of a method.
+var notes = map[string]string{
+	"Notification": "It bypasses the bookkeeping of Subscribe, which most callers want instead.",
+	"CloseTargets": "It is named so as not to clash with Client.Close.",
+}
+
+// recent lists the requests that older versions of iTerm2
+// answer with an error. Their stubs report ErrUnsupported.
+var recent = map[string]bool{
+	"ListPromptsRequest":    true,
+	"InvokeFunctionRequest": true,
+	"CloseRequest":          true,
+}
+
+type stub struct {
+	Method   string
+	Note     string
+	Recent   bool
+	Request  string
+	Response string
+	// ReqField and RespField are the Go names of the oneof fields.
+	ReqField  string
+	RespField string
+}
+
+func main() {
+	out := flag.String("o", "stubs.go", "output file")
+	flag.Parse()
+	stubs, err := collect()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, stubs); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("error formatting generated code: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func collect() ([]stub, error) {
+	reqs := submessages(api.File_api_proto.Messages().ByName("ClientOriginatedMessage"))
+	resps := submessages(api.File_api_proto.Messages().ByName("ServerOriginatedMessage"))
+	var stubs []stub
+	for i := 0; i < reqs.Len(); i++ {
+		req := reqs.Get(i)
+		resp := resps.ByNumber(req.Number())
+		if resp == nil {
+			return nil, fmt.Errorf("%s has no response", req.Name())
+		}
+		if req.Message() == nil || resp.Message() == nil {
+			return nil, fmt.Errorf("%s is not a message", req.Name())
+		}
+		name := string(req.Message().Name())
+		method := strings.TrimSuffix(name, "Request")
+		if r, ok := renames[method]; ok {
+			method = r
+		}
+		stubs = append(stubs, stub{
+			Method:    method,
+			Note:      notes[method],
+			Recent:    recent[name],
+			Request:   name,
+			Response:  string(resp.Message().Name()),
+			ReqField:  goName(req.Name()),
+			RespField: goName(resp.Name()),
+		})
+	}
+	return stubs, nil
+}
+
+func submessages(md protoreflect.MessageDescriptor) protoreflect.FieldDescriptors {
+	return md.Oneofs().ByName("submessage").Fields()
+}
+
+func article(word string) string {
+	if strings.ContainsAny(word[:1], "AEIOU") {
+		return "an"
+	}
+	return "a"
+}
+
+// goName returns the name that protoc-gen-go gives to a field.
+func goName(name protoreflect.Name) string {
+	parts := strings.Split(string(name), "_")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+var tmpl = template.Must(template.New("stubs").Funcs(template.FuncMap{"article": article}).Parse(`// Code generated by genstubs. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+
+	"marwan.io/iterm2/api"
+)
+{{range .}}
+// {{.Method}} sends {{article .Request}} {{.Request}} and returns the
+// {{.Response}} that iTerm2 answers it with.
+{{- with .Note}}
+// {{.}}
+{{- end}}
+{{- if .Recent}}
+// Older versions of iTerm2 make it fail with ErrUnsupported.
+{{- end}}
+func (c *Client) {{.Method}}(ctx context.Context, req *api.{{.Request}}) (*api.{{.Response}}, error) {
+	resp, err := c.CallContext(ctx, &api.ClientOriginatedMessage{
+		Submessage: &api.ClientOriginatedMessage_{{.ReqField}}{ {{- .ReqField}}: req},
+	})
+	if err != nil {
+		return nil, {{if .Recent}}unsupported("{{.Request}}", err){{else}}err{{end}}
+	}
+	sub, ok := resp.GetSubmessage().(*api.ServerOriginatedMessage_{{.RespField}})
+	if !ok {
+		return nil, unexpectedResponse("{{.Request}}", resp)
+	}
+	return sub.{{.RespField}}, nil
+}
+{{end}}`))
@@ -0,0 +1,476 @@
+package iterm2test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"marwan.io/iterm2/api"
+)
+
+// handle dispatches a request to the model. It must be
+// called with s.mu held.
+func (s *Server) handle(c *conn, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, []*api.Notification) {
+	switch sub := req.GetSubmessage().(type) {
+	case *api.ClientOriginatedMessage_CreateTabRequest:
+		resp, notes := s.createTab(sub.CreateTabRequest)
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_CreateTabResponse{CreateTabResponse: resp},
+		}, notes
+	case *api.ClientOriginatedMessage_SplitPaneRequest:
+		resp, notes := s.splitPane(sub.SplitPaneRequest)
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_SplitPaneResponse{SplitPaneResponse: resp},
+		}, notes
+	case *api.ClientOriginatedMessage_ListSessionsRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_ListSessionsResponse{ListSessionsResponse: s.listSessions()},
+		}, nil
+	case *api.ClientOriginatedMessage_SendTextRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_SendTextResponse{SendTextResponse: s.sendText(sub.SendTextRequest)},
+		}, nil
+	case *api.ClientOriginatedMessage_ActivateRequest:
+		resp, notes := s.activate(sub.ActivateRequest)
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_ActivateResponse{ActivateResponse: resp},
+		}, notes
+	case *api.ClientOriginatedMessage_VariableRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_VariableResponse{VariableResponse: s.variable(sub.VariableRequest)},
+		}, nil
+	case *api.ClientOriginatedMessage_GetBufferRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_GetBufferResponse{GetBufferResponse: s.getBuffer(sub.GetBufferRequest)},
+		}, nil
+	case *api.ClientOriginatedMessage_GetPropertyRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_GetPropertyResponse{GetPropertyResponse: s.getProperty(sub.GetPropertyRequest)},
+		}, nil
+	case *api.ClientOriginatedMessage_InvokeFunctionRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_InvokeFunctionResponse{InvokeFunctionResponse: s.invokeFunction(sub.InvokeFunctionRequest)},
+		}, nil
+	case *api.ClientOriginatedMessage_MenuItemRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_MenuItemResponse{MenuItemResponse: &api.MenuItemResponse{
+				Status: api.MenuItemResponse_OK.Enum(),
+			}},
+		}, nil
+	case *api.ClientOriginatedMessage_TransactionRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_TransactionResponse{TransactionResponse: s.transaction(c, sub.TransactionRequest)},
+		}, nil
+	case *api.ClientOriginatedMessage_CloseRequest:
+		resp, notes := s.close(sub.CloseRequest)
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_CloseResponse{CloseResponse: resp},
+		}, notes
+	case *api.ClientOriginatedMessage_NotificationRequest:
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_NotificationResponse{NotificationResponse: s.notification(c, sub.NotificationRequest)},
+		}, nil
+	}
+	// Like a version of iTerm2 that predates the request:
+	// its fields are dropped while decoding, which leaves
+	// no submessage set.
+	return &api.ServerOriginatedMessage{
+		Submessage: &api.ServerOriginatedMessage_Error{Error: "Invalid request"},
+	}, nil
+}
+
+func (s *Server) createTab(req *api.CreateTabRequest) (*api.CreateTabResponse, []*api.Notification) {
+	if req.ProfileName != nil && !s.profiles[req.GetProfileName()] {
+		return &api.CreateTabResponse{Status: api.CreateTabResponse_INVALID_PROFILE_NAME.Enum()}, nil
+	}
+	status := api.CreateTabResponse_OK
+	var w *window
+	index := -1
+	if req.WindowId != nil {
+		w = s.window(req.GetWindowId())
+		if w == nil {
+			return &api.CreateTabResponse{Status: api.CreateTabResponse_INVALID_WINDOW_ID.Enum()}, nil
+		}
+		if req.TabIndex != nil {
+			index = int(req.GetTabIndex())
+			if index > len(w.tabs) {
+				status = api.CreateTabResponse_INVALID_TAB_INDEX
+			}
+		}
+	} else {
+		w = s.newWindow()
+	}
+	t := s.newTab(w, index)
+	sess := t.root.links[0].session
+	applyProfileProperties(sess, req.GetCustomProfileProperties())
+	tabID, _ := strconv.Atoi(t.id)
+	return &api.CreateTabResponse{
+		Status:    status.Enum(),
+		WindowId:  str(w.id),
+		TabId:     i32(int32(tabID)),
+		SessionId: str(sess.id),
+	}, s.created(sess)
+}
+
+func (s *Server) splitPane(req *api.SplitPaneRequest) (*api.SplitPaneResponse, []*api.Notification) {
+	target, ok := s.lookupSession(req.GetSession())
+	if !ok {
+		return &api.SplitPaneResponse{Status: api.SplitPaneResponse_SESSION_NOT_FOUND.Enum()}, nil
+	}
+	if req.ProfileName != nil && !s.profiles[req.GetProfileName()] {
+		return &api.SplitPaneResponse{Status: api.SplitPaneResponse_INVALID_PROFILE_NAME.Enum()}, nil
+	}
+	for _, p := range req.GetCustomProfileProperties() {
+		if !json.Valid([]byte(p.GetJsonValue())) {
+			return &api.SplitPaneResponse{Status: api.SplitPaneResponse_MALFORMED_CUSTOM_PROFILE_PROPERTY.Enum()}, nil
+		}
+	}
+	vertical := req.GetSplitDirection() == api.SplitPaneRequest_VERTICAL
+	if vertical && target.screen.cols < 3 || !vertical && target.screen.rows < 3 {
+		return &api.SplitPaneResponse{Status: api.SplitPaneResponse_CANNOT_SPLIT.Enum()}, nil
+	}
+	sess := s.split(target, vertical, req.GetBefore())
+	applyProfileProperties(sess, req.GetCustomProfileProperties())
+	return &api.SplitPaneResponse{
+		Status:    api.SplitPaneResponse_OK.Enum(),
+		SessionId: []string{sess.id},
+	}, s.created(sess)
+}
+
+// created returns the notifications iTerm2
+// posts when a new session appears.
+func (s *Server) created(sess *session) []*api.Notification {
+	return []*api.Notification{
+		{NewSessionNotification: &api.NewSessionNotification{SessionId: str(sess.id)}},
+		{LayoutChangedNotification: &api.LayoutChangedNotification{ListSessionsResponse: s.listSessions()}},
+	}
+}
+
+// applyProfileProperties stores custom profile properties
+// as session variables so tests can inspect them.
+func applyProfileProperties(sess *session, props []*api.ProfileProperty) {
+	for _, p := range props {
+		sess.vars["profile."+p.GetKey()] = p.GetJsonValue()
+	}
+}
+
+func (s *Server) sendText(req *api.SendTextRequest) *api.SendTextResponse {
+	sess, ok := s.lookupSession(req.GetSession())
+	if !ok {
+		return &api.SendTextResponse{Status: api.SendTextResponse_SESSION_NOT_FOUND.Enum()}
+	}
+	sess.input.WriteString(req.GetText())
+	sess.screen.write(req.GetText())
+	return &api.SendTextResponse{Status: api.SendTextResponse_OK.Enum()}
+}
+
+func (s *Server) activate(req *api.ActivateRequest) (*api.ActivateResponse, []*api.Notification) {
+	var target *session
+	switch id := req.GetIdentifier().(type) {
+	case *api.ActivateRequest_SessionId:
+		sess, ok := s.lookupSession(id.SessionId)
+		if !ok {
+			return &api.ActivateResponse{Status: api.ActivateResponse_BAD_IDENTIFIER.Enum()}, nil
+		}
+		target = sess
+	case *api.ActivateRequest_TabId:
+		t, ok := s.tabs[id.TabId]
+		if !ok {
+			return &api.ActivateResponse{Status: api.ActivateResponse_BAD_IDENTIFIER.Enum()}, nil
+		}
+		target = t.firstSession()
+	case *api.ActivateRequest_WindowId:
+		w := s.window(id.WindowId)
+		if w == nil {
+			return &api.ActivateResponse{Status: api.ActivateResponse_BAD_IDENTIFIER.Enum()}, nil
+		}
+		if len(w.tabs) > 0 {
+			target = w.tabs[0].firstSession()
+		}
+	}
+	ok := &api.ActivateResponse{Status: api.ActivateResponse_OK.Enum()}
+	if target == nil || target == s.active {
+		return ok, nil
+	}
+	s.active = target
+	return ok, []*api.Notification{{
+		FocusChangedNotification: &api.FocusChangedNotification{
+			Event: &api.FocusChangedNotification_Session{Session: target.id},
+		},
+	}}
+}
+
+func (t *tab) firstSession() *session {
+	n := t.root
+	for len(n.links) > 0 {
+		if n.links[0].session != nil {
+			return n.links[0].session
+		}
+		n = n.links[0].node
+	}
+	return nil
+}
+
+func (s *Server) variable(req *api.VariableRequest) *api.VariableResponse {
+	var vars, builtins map[string]string
+	switch scope := req.GetScope().(type) {
+	case *api.VariableRequest_SessionId:
+		sess, ok := s.lookupSession(scope.SessionId)
+		if !ok {
+			return &api.VariableResponse{Status: api.VariableResponse_SESSION_NOT_FOUND.Enum()}
+		}
+		vars, builtins = sess.vars, sess.builtins()
+	case *api.VariableRequest_TabId:
+		t, ok := s.tabs[scope.TabId]
+		if !ok {
+			return &api.VariableResponse{Status: api.VariableResponse_TAB_NOT_FOUND.Enum()}
+		}
+		vars = t.vars
+	case *api.VariableRequest_WindowId:
+		w := s.window(scope.WindowId)
+		if w == nil {
+			return &api.VariableResponse{Status: api.VariableResponse_WINDOW_NOT_FOUND.Enum()}
+		}
+		vars = w.vars
+	case *api.VariableRequest_App:
+		vars = s.appVars
+	default:
+		return &api.VariableResponse{Status: api.VariableResponse_MISSING_SCOPE.Enum()}
+	}
+	for _, set := range req.GetSet() {
+		if !strings.HasPrefix(set.GetName(), "user.") {
+			return &api.VariableResponse{Status: api.VariableResponse_INVALID_NAME.Enum()}
+		}
+	}
+	for _, set := range req.GetSet() {
+		vars[set.GetName()] = set.GetValue()
+	}
+	resp := &api.VariableResponse{Status: api.VariableResponse_OK.Enum()}
+	for _, name := range req.GetGet() {
+		if name == "*" {
+			all := make(map[string]json.RawMessage, len(vars)+len(builtins))
+			for k, v := range builtins {
+				all[k] = json.RawMessage(v)
+			}
+			for k, v := range vars {
+				all[k] = json.RawMessage(v)
+			}
+			b, _ := json.Marshal(all)
+			resp.Values = append(resp.Values, string(b))
+			continue
+		}
+		v, ok := vars[name]
+		if !ok {
+			v, ok = builtins[name]
+		}
+		if !ok {
+			v = "null"
+		}
+		resp.Values = append(resp.Values, v)
+	}
+	return resp
+}
+
+// builtins returns the read-only variables
+// iTerm2 defines for every session.
+func (sess *session) builtins() map[string]string {
+	return map[string]string{
+		"id":     jsonString(sess.id),
+		"name":   jsonString(sess.title),
+		"tab.id": jsonString(sess.tab.id),
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (s *Server) getBuffer(req *api.GetBufferRequest) *api.GetBufferResponse {
+	sess, ok := s.lookupSession(req.GetSession())
+	if !ok {
+		return &api.GetBufferResponse{Status: api.GetBufferResponse_SESSION_NOT_FOUND.Enum()}
+	}
+	sc := &sess.screen
+	end := sc.overflow + int64(len(sc.lines))
+	lr := req.GetLineRange()
+	switch {
+	case lr.GetScreenContentsOnly():
+		return sc.getBuffer(end-int64(sc.rows), end)
+	case lr.TrailingLines != nil:
+		if lr.GetTrailingLines() < 0 {
+			return &api.GetBufferResponse{Status: api.GetBufferResponse_INVALID_LINE_RANGE.Enum()}
+		}
+		return sc.getBuffer(end-int64(lr.GetTrailingLines()), end)
+	case lr.WindowedCoordRange != nil:
+		cr := lr.GetWindowedCoordRange().GetCoordRange()
+		from, to := cr.GetStart().GetY(), cr.GetEnd().GetY()
+		if cr.GetEnd().GetX() > 0 {
+			to++
+		}
+		if to < from {
+			return &api.GetBufferResponse{Status: api.GetBufferResponse_INVALID_LINE_RANGE.Enum()}
+		}
+		return sc.getBuffer(from, to)
+	}
+	return &api.GetBufferResponse{Status: api.GetBufferResponse_REQUEST_MALFORMED.Enum()}
+}
+
+func (s *Server) getProperty(req *api.GetPropertyRequest) *api.GetPropertyResponse {
+	sess, ok := s.lookupSession(req.GetSessionId())
+	if !ok {
+		return &api.GetPropertyResponse{Status: api.GetPropertyResponse_INVALID_TARGET.Enum()}
+	}
+	var v interface{}
+	switch req.GetName() {
+	case "grid_size":
+		v = map[string]int{"width": sess.screen.cols, "height": sess.screen.rows}
+	case "number_of_lines":
+		v = map[string]int64{
+			"overflow": sess.screen.overflow,
+			"grid":     int64(sess.screen.rows),
+			"history":  int64(sess.screen.history()),
+		}
+	case "buried":
+		v = false
+	default:
+		return &api.GetPropertyResponse{Status: api.GetPropertyResponse_UNRECOGNIZED_NAME.Enum()}
+	}
+	b, _ := json.Marshal(v)
+	return &api.GetPropertyResponse{
+		Status:    api.GetPropertyResponse_OK.Enum(),
+		JsonValue: str(string(b)),
+	}
+}
+
+var setTitleRe = regexp.MustCompile(`^(?:iterm2\.)?set_title\(title: (".*")\)$`)
+
+// invokeFunction only knows how to set the title
+// of a window, tab or session.
+func (s *Server) invokeFunction(req *api.InvokeFunctionRequest) *api.InvokeFunctionResponse {
+	m := setTitleRe.FindStringSubmatch(req.GetInvocation())
+	if m == nil || req.GetMethod() == nil {
+		return invokeError(api.InvokeFunctionResponse_FAILED, "unknown function: "+req.GetInvocation())
+	}
+	var title string
+	if err := json.Unmarshal([]byte(m[1]), &title); err != nil {
+		return invokeError(api.InvokeFunctionResponse_REQUEST_MALFORMED, err.Error())
+	}
+	id := req.GetMethod().GetReceiver()
+	if sess, ok := s.sessions[id]; ok {
+		sess.title = title
+	} else if t, ok := s.tabs[id]; ok {
+		t.title = title
+	} else if w := s.window(id); w != nil {
+		w.title = title
+	} else {
+		return invokeError(api.InvokeFunctionResponse_INVALID_ID, "no such receiver: "+id)
+	}
+	return &api.InvokeFunctionResponse{
+		Disposition: &api.InvokeFunctionResponse_Success_{
+			Success: &api.InvokeFunctionResponse_Success{JsonResult: str("null")},
+		},
+	}
+}
+
+func invokeError(status api.InvokeFunctionResponse_Status, reason string) *api.InvokeFunctionResponse {
+	return &api.InvokeFunctionResponse{
+		Disposition: &api.InvokeFunctionResponse_Error_{
+			Error: &api.InvokeFunctionResponse_Error{
+				Status:      status.Enum(),
+				ErrorReason: str(reason),
+			},
+		},
+	}
+}
+
+func (s *Server) notification(c *conn, req *api.NotificationRequest) *api.NotificationResponse {
+	sub := subscription{typ: req.GetNotificationType(), session: req.GetSession()}
+	if req.GetSubscribe() {
+		if c.subs[sub] {
+			return &api.NotificationResponse{Status: api.NotificationResponse_ALREADY_SUBSCRIBED.Enum()}
+		}
+		c.subs[sub] = true
+	} else {
+		if !c.subs[sub] {
+			return &api.NotificationResponse{Status: api.NotificationResponse_NOT_SUBSCRIBED.Enum()}
+		}
+		delete(c.subs, sub)
+	}
+	return &api.NotificationResponse{Status: api.NotificationResponse_OK.Enum()}
+}
+
+func (s *Server) transaction(c *conn, req *api.TransactionRequest) *api.TransactionResponse {
+	if req.GetBegin() {
+		if s.tx == c {
+			return &api.TransactionResponse{Status: api.TransactionResponse_ALREADY_IN_TRANSACTION.Enum()}
+		}
+		s.tx = c
+	} else {
+		if s.tx != c {
+			return &api.TransactionResponse{Status: api.TransactionResponse_NO_TRANSACTION.Enum()}
+		}
+		s.tx = nil
+		s.txDone.Broadcast()
+	}
+	return &api.TransactionResponse{Status: api.TransactionResponse_OK.Enum()}
+}
+
+// close never asks for confirmation: every
+// target that exists is closed, forced or not.
+func (s *Server) close(req *api.CloseRequest) (*api.CloseResponse, []*api.Notification) {
+	resp := &api.CloseResponse{}
+	var closed []*session
+	status := func(ok bool) {
+		if ok {
+			resp.Statuses = append(resp.Statuses, api.CloseResponse_OK)
+		} else {
+			resp.Statuses = append(resp.Statuses, api.CloseResponse_NOT_FOUND)
+		}
+	}
+	switch target := req.GetTarget().(type) {
+	case *api.CloseRequest_Sessions:
+		for _, id := range target.Sessions.GetSessionIds() {
+			sess, ok := s.sessions[id]
+			if ok {
+				closed = append(closed, sess)
+				s.removeSession(sess)
+			}
+			status(ok)
+		}
+	case *api.CloseRequest_Tabs:
+		for _, id := range target.Tabs.GetTabIds() {
+			t, ok := s.tabs[id]
+			if ok {
+				closed = append(closed, t.sessions()...)
+				s.removeTab(t)
+			}
+			status(ok)
+		}
+	case *api.CloseRequest_Windows:
+		for _, id := range target.Windows.GetWindowIds() {
+			w := s.window(id)
+			if w != nil {
+				for _, t := range append([]*tab(nil), w.tabs...) {
+					closed = append(closed, t.sessions()...)
+					s.removeTab(t)
+				}
+			}
+			status(w != nil)
+		}
+	}
+	if len(closed) == 0 {
+		return resp, nil
+	}
+	var notes []*api.Notification
+	for _, sess := range closed {
+		notes = append(notes, &api.Notification{
+			TerminateSessionNotification: &api.TerminateSessionNotification{SessionId: str(sess.id)},
+		})
+	}
+	notes = append(notes, &api.Notification{
+		LayoutChangedNotification: &api.LayoutChangedNotification{ListSessionsResponse: s.listSessions()},
+	})
+	return resp, notes
+}
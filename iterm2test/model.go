@@ -0,0 +1,389 @@
+package iterm2test
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"marwan.io/iterm2/api"
+)
+
+const (
+	defaultCols = 80
+	defaultRows = 25
+	cellWidth   = 7
+	cellHeight  = 14
+)
+
+type window struct {
+	id     string
+	number int32
+	title  string
+	tabs   []*tab
+	vars   map[string]string
+}
+
+type tab struct {
+	id     string
+	window *window
+	title  string
+	root   *node
+	vars   map[string]string
+}
+
+// node is a split pane container. All of its
+// links are laid out along the same axis.
+type node struct {
+	vertical bool
+	parent   *node
+	links    []link
+}
+
+// link holds exactly one of session or node.
+type link struct {
+	session *session
+	node    *node
+}
+
+type session struct {
+	id     string
+	tab    *tab
+	parent *node
+	title  string
+	vars   map[string]string
+	input  strings.Builder
+	screen screen
+}
+
+// Write appends text to the screen of the given session as
+// if the program running in it had printed it.
+func (s *Server) Write(sessionID, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session %q not found", sessionID)
+	}
+	sess.screen.write(text)
+	return nil
+}
+
+// Input returns all the text that was sent to
+// the given session through SendText requests.
+func (s *Server) Input(sessionID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return ""
+	}
+	return sess.input.String()
+}
+
+// Title returns the title of the window,
+// tab or session with the given id.
+func (s *Server) Title(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, ok := s.sessions[id]; ok {
+		return sess.title
+	}
+	if t, ok := s.tabs[id]; ok {
+		return t.title
+	}
+	if w := s.window(id); w != nil {
+		return w.title
+	}
+	return ""
+}
+
+// SetHistoryLimit bounds how many lines of scrollback history the
+// given session keeps. Once exceeded, the oldest lines are lost
+// the way they are in a real terminal. Zero means unlimited.
+func (s *Server) SetHistoryLimit(sessionID string, lines int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[sessionID]
+	if !ok {
+		return fmt.Errorf("session %q not found", sessionID)
+	}
+	sess.screen.maxHistory = lines
+	sess.screen.trim()
+	return nil
+}
+
+func (s *Server) newID() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) newWindow() *window {
+	n := s.newID()
+	w := &window{
+		id:     fmt.Sprintf("pty-%08X-0000-4000-8000-%012X", n, n),
+		number: s.nextNumber,
+		vars:   make(map[string]string),
+	}
+	s.nextNumber++
+	s.windows = append(s.windows, w)
+	return w
+}
+
+func (s *Server) newTab(w *window, index int) *tab {
+	t := &tab{
+		id:     strconv.Itoa(s.newID()),
+		window: w,
+		vars:   make(map[string]string),
+	}
+	t.root = &node{}
+	sess := s.newSession(t, defaultCols, defaultRows)
+	sess.parent = t.root
+	t.root.links = []link{{session: sess}}
+	if index < 0 || index > len(w.tabs) {
+		index = len(w.tabs)
+	}
+	w.tabs = append(w.tabs, nil)
+	copy(w.tabs[index+1:], w.tabs[index:])
+	w.tabs[index] = t
+	s.tabs[t.id] = t
+	return t
+}
+
+func (s *Server) newSession(t *tab, cols, rows int) *session {
+	n := s.newID()
+	sess := &session{
+		id:    fmt.Sprintf("%08X-0000-4000-8000-%012X", n, n),
+		tab:   t,
+		title: "Default",
+		vars:  make(map[string]string),
+	}
+	sess.screen.cols = cols
+	sess.screen.rows = rows
+	s.sessions[sess.id] = sess
+	if s.active == nil {
+		s.active = sess
+	}
+	return sess
+}
+
+// split divides target in two along the given axis the way iTerm2
+// does: the new session joins target's container if it already runs
+// along that axis, otherwise target is replaced by a new container
+// holding both sessions.
+func (s *Server) split(target *session, vertical, before bool) *session {
+	cols, rows := target.screen.cols, target.screen.rows
+	if vertical {
+		cols = (cols - 1) / 2
+	} else {
+		rows = (rows - 1) / 2
+	}
+	target.screen.cols, target.screen.rows = cols, rows
+	sess := s.newSession(target.tab, cols, rows)
+	p := target.parent
+	i := p.index(target)
+	if len(p.links) == 1 {
+		p.vertical = vertical
+	}
+	if p.vertical == vertical {
+		if !before {
+			i++
+		}
+		p.links = append(p.links, link{})
+		copy(p.links[i+1:], p.links[i:])
+		p.links[i] = link{session: sess}
+		sess.parent = p
+		return sess
+	}
+	n := &node{vertical: vertical, parent: p}
+	if before {
+		n.links = []link{{session: sess}, {session: target}}
+	} else {
+		n.links = []link{{session: target}, {session: sess}}
+	}
+	target.parent = n
+	sess.parent = n
+	p.links[i] = link{node: n}
+	return sess
+}
+
+// removeSession takes sess out of its tab, dropping the
+// containers, tab and window that it leaves empty.
+func (s *Server) removeSession(sess *session) {
+	delete(s.sessions, sess.id)
+	if s.active == sess {
+		s.active = nil
+	}
+	n := sess.parent
+	i := n.index(sess)
+	n.links = append(n.links[:i], n.links[i+1:]...)
+	for n.parent != nil && len(n.links) <= 1 {
+		p := n.parent
+		i := p.nodeIndex(n)
+		if len(n.links) == 0 {
+			p.links = append(p.links[:i], p.links[i+1:]...)
+		} else {
+			// A container with a single child is replaced by it.
+			l := n.links[0]
+			if l.session != nil {
+				l.session.parent = p
+			} else {
+				l.node.parent = p
+			}
+			p.links[i] = l
+		}
+		n = p
+	}
+	if len(sess.tab.root.links) == 0 {
+		s.removeTab(sess.tab)
+	}
+}
+
+// removeTab takes t and its sessions out of its
+// window, dropping the window if it is left empty.
+func (s *Server) removeTab(t *tab) {
+	for _, sess := range t.sessions() {
+		delete(s.sessions, sess.id)
+		if s.active == sess {
+			s.active = nil
+		}
+	}
+	delete(s.tabs, t.id)
+	w := t.window
+	for i, wt := range w.tabs {
+		if wt == t {
+			w.tabs = append(w.tabs[:i], w.tabs[i+1:]...)
+			break
+		}
+	}
+	if len(w.tabs) == 0 {
+		for i, sw := range s.windows {
+			if sw == w {
+				s.windows = append(s.windows[:i], s.windows[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// sessions returns every session of t in layout order.
+func (t *tab) sessions() []*session {
+	var list []*session
+	var walk func(n *node)
+	walk = func(n *node) {
+		for _, l := range n.links {
+			if l.session != nil {
+				list = append(list, l.session)
+			} else {
+				walk(l.node)
+			}
+		}
+	}
+	walk(t.root)
+	return list
+}
+
+func (n *node) nodeIndex(child *node) int {
+	for i, l := range n.links {
+		if l.node == child {
+			return i
+		}
+	}
+	return -1
+}
+
+func (n *node) index(sess *session) int {
+	for i, l := range n.links {
+		if l.session == sess {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) window(id string) *window {
+	for _, w := range s.windows {
+		if w.id == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// lookupSession resolves a session id, including
+// the special value "active".
+func (s *Server) lookupSession(id string) (*session, bool) {
+	if id == "active" {
+		return s.active, s.active != nil
+	}
+	sess, ok := s.sessions[id]
+	return sess, ok
+}
+
+func (s *Server) listSessions() *api.ListSessionsResponse {
+	resp := &api.ListSessionsResponse{}
+	for _, w := range s.windows {
+		lw := &api.ListSessionsResponse_Window{
+			WindowId: str(w.id),
+			Number:   i32(w.number),
+			Frame:    frame(defaultCols, defaultRows),
+		}
+		for _, t := range w.tabs {
+			lw.Tabs = append(lw.Tabs, &api.ListSessionsResponse_Tab{
+				TabId: str(t.id),
+				Root:  t.root.proto(),
+			})
+		}
+		resp.Windows = append(resp.Windows, lw)
+	}
+	return resp
+}
+
+func (n *node) proto() *api.SplitTreeNode {
+	pn := &api.SplitTreeNode{Vertical: &n.vertical}
+	for _, l := range n.links {
+		if l.node != nil {
+			pn.Links = append(pn.Links, &api.SplitTreeNode_SplitTreeLink{
+				Child: &api.SplitTreeNode_SplitTreeLink_Node{Node: l.node.proto()},
+			})
+			continue
+		}
+		pn.Links = append(pn.Links, &api.SplitTreeNode_SplitTreeLink{
+			Child: &api.SplitTreeNode_SplitTreeLink_Session{Session: l.session.summary()},
+		})
+	}
+	return pn
+}
+
+func (sess *session) summary() *api.SessionSummary {
+	return &api.SessionSummary{
+		UniqueIdentifier: str(sess.id),
+		Title:            str(sess.title),
+		Frame:            frame(sess.screen.cols, sess.screen.rows),
+		GridSize: &api.Size{
+			Width:  i32(int32(sess.screen.cols)),
+			Height: i32(int32(sess.screen.rows)),
+		},
+	}
+}
+
+func frame(cols, rows int) *api.Frame {
+	return &api.Frame{
+		Origin: &api.Point{X: i32(0), Y: i32(0)},
+		Size: &api.Size{
+			Width:  i32(int32(cols * cellWidth)),
+			Height: i32(int32(rows * cellHeight)),
+		},
+	}
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func i32(i int32) *int32 {
+	return &i
+}
+
+func i64(i int64) *int64 {
+	return &i
+}
@@ -0,0 +1,184 @@
+package iterm2test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// Replay is a fake iTerm2 that serves back a recording made with
+// client.Recorder. Each incoming request is matched with the first
+// recorded request of the same kind that was not replayed yet and
+// gets that request's recorded response, followed by the
+// notifications that iTerm2 sent before the next recorded request.
+// Notifications recorded before any request are sent as soon as a
+// client connects.
+type Replay struct {
+	// URL is the websocket endpoint of the server.
+	URL string
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu      sync.Mutex
+	initial []*api.ServerOriginatedMessage
+	steps   []*step
+	err     error
+}
+
+// step is a recorded request along with what iTerm2 sent because of it.
+type step struct {
+	kind     string
+	response *api.ServerOriginatedMessage
+	notes    []*api.ServerOriginatedMessage
+	replayed bool
+}
+
+// NewReplay starts a server that replays records.
+func NewReplay(records []client.Record) (*Replay, error) {
+	r := &Replay{
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{"api.iterm2.com"},
+			CheckOrigin:  func(*http.Request) bool { return true },
+		},
+	}
+	byID := map[int64]*step{}
+	var cur *step
+	for i, rec := range records {
+		m, err := rec.Decode()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding record %d: %w", i, err)
+		}
+		switch msg := m.(type) {
+		case *api.ClientOriginatedMessage:
+			cur = &step{kind: requestKind(msg)}
+			byID[msg.GetId()] = cur
+			r.steps = append(r.steps, cur)
+		case *api.ServerOriginatedMessage:
+			if msg.GetNotification() != nil {
+				if cur == nil {
+					r.initial = append(r.initial, msg)
+				} else {
+					cur.notes = append(cur.notes, msg)
+				}
+				continue
+			}
+			if s, ok := byID[msg.GetId()]; ok {
+				s.response = msg
+			}
+		}
+	}
+	r.srv = httptest.NewServer(http.HandlerFunc(r.serveHTTP))
+	r.URL = "ws" + strings.TrimPrefix(r.srv.URL, "http")
+	return r, nil
+}
+
+// Options returns the client options needed to connect to r.
+func (r *Replay) Options() client.Options {
+	return client.Options{
+		URL:  r.URL,
+		Auth: []client.Authenticator{client.StaticAuth{Cookie: Cookie}},
+	}
+}
+
+// Close shuts down the server.
+func (r *Replay) Close() {
+	r.srv.CloseClientConnections()
+	r.srv.Close()
+}
+
+// Err returns the first request that did not match the recording.
+func (r *Replay) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Remaining returns how many recorded requests were not replayed yet.
+func (r *Replay) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int
+	for _, s := range r.steps {
+		if !s.replayed {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Replay) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	ws, err := r.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+	c := &conn{ws: ws}
+	r.mu.Lock()
+	initial := r.initial
+	r.mu.Unlock()
+	for _, n := range initial {
+		if c.send(n) != nil {
+			return
+		}
+	}
+	for {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var in api.ClientOriginatedMessage
+		if err := proto.Unmarshal(msg, &in); err != nil {
+			return
+		}
+		for _, out := range r.next(&in) {
+			if c.send(out) != nil {
+				return
+			}
+		}
+	}
+}
+
+// next returns the messages to send in reply to req.
+func (r *Replay) next(req *api.ClientOriginatedMessage) []*api.ServerOriginatedMessage {
+	kind := requestKind(req)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.steps {
+		if s.replayed || s.kind != kind {
+			continue
+		}
+		s.replayed = true
+		var out []*api.ServerOriginatedMessage
+		if s.response != nil {
+			resp := proto.Clone(s.response).(*api.ServerOriginatedMessage)
+			resp.Id = req.Id
+			out = append(out, resp)
+		}
+		return append(out, s.notes...)
+	}
+	err := fmt.Errorf("replay: unexpected %s", kind)
+	if r.err == nil {
+		r.err = err
+	}
+	return []*api.ServerOriginatedMessage{{
+		Id:         req.Id,
+		Submessage: &api.ServerOriginatedMessage_Error{Error: err.Error()},
+	}}
+}
+
+func requestKind(req *api.ClientOriginatedMessage) string {
+	m := req.ProtoReflect()
+	fd := m.WhichOneof(m.Descriptor().Oneofs().ByName("submessage"))
+	if fd == nil {
+		return "unknown request"
+	}
+	return string(fd.Message().Name())
+}
@@ -0,0 +1,137 @@
+package iterm2test
+
+import (
+	"unicode"
+
+	"marwan.io/iterm2/api"
+)
+
+// screen is the contents of a session: its scrollback
+// history followed by the visible grid.
+type screen struct {
+	cols, rows int
+	// lines holds every line that is still available. The
+	// first of them has the stable line number overflow.
+	lines      []line
+	overflow   int64
+	maxHistory int
+}
+
+// line is a row of cells, each holding the code points drawn in it.
+type line struct {
+	cells []string
+	soft  bool
+}
+
+// write appends text the way a terminal prints it: newlines end a
+// line, long lines wrap into soft continuations and combining marks
+// join the cell before them.
+func (sc *screen) write(text string) {
+	if len(sc.lines) == 0 {
+		sc.lines = []line{{}}
+	}
+	for _, r := range text {
+		cur := &sc.lines[len(sc.lines)-1]
+		switch {
+		case r == '\r':
+		case r == '\n':
+			sc.lines = append(sc.lines, line{})
+		case unicode.Is(unicode.Mn, r) && len(cur.cells) > 0:
+			cur.cells[len(cur.cells)-1] += string(r)
+		default:
+			if len(cur.cells) >= sc.cols {
+				cur.soft = true
+				sc.lines = append(sc.lines, line{})
+				cur = &sc.lines[len(sc.lines)-1]
+			}
+			cur.cells = append(cur.cells, string(r))
+		}
+	}
+	sc.trim()
+}
+
+// trim drops the oldest lines once the history limit is exceeded.
+func (sc *screen) trim() {
+	if sc.maxHistory <= 0 {
+		return
+	}
+	if extra := len(sc.lines) - sc.rows - sc.maxHistory; extra > 0 {
+		sc.lines = append([]line(nil), sc.lines[extra:]...)
+		sc.overflow += int64(extra)
+	}
+}
+
+// history returns the number of available
+// lines that are above the visible grid.
+func (sc *screen) history() int {
+	if h := len(sc.lines) - sc.rows; h > 0 {
+		return h
+	}
+	return 0
+}
+
+func (sc *screen) cursor() *api.Coord {
+	if len(sc.lines) == 0 {
+		return &api.Coord{X: i32(0), Y: i64(sc.overflow)}
+	}
+	last := sc.lines[len(sc.lines)-1]
+	return &api.Coord{
+		X: i32(int32(len(last.cells))),
+		Y: i64(sc.overflow + int64(len(sc.lines)-1)),
+	}
+}
+
+// getBuffer answers a GetBufferRequest for lines [from, to)
+// in stable line numbers, clamped to what is still available.
+func (sc *screen) getBuffer(from, to int64) *api.GetBufferResponse {
+	end := sc.overflow + int64(len(sc.lines))
+	if from < sc.overflow {
+		from = sc.overflow
+	}
+	if to > end {
+		to = end
+	}
+	if to < from {
+		to = from
+	}
+	resp := &api.GetBufferResponse{
+		Status: api.GetBufferResponse_OK.Enum(),
+		Cursor: sc.cursor(),
+		WindowedCoordRange: &api.WindowedCoordRange{
+			CoordRange: &api.CoordRange{
+				Start: &api.Coord{X: i32(0), Y: i64(from)},
+				End:   &api.Coord{X: i32(0), Y: i64(to)},
+			},
+		},
+		NumLinesAboveScreen: i64(sc.overflow + int64(sc.history())),
+	}
+	for y := from; y < to; y++ {
+		resp.Contents = append(resp.Contents, sc.lines[y-sc.overflow].proto())
+	}
+	return resp
+}
+
+func (l line) proto() *api.LineContents {
+	lc := &api.LineContents{
+		Continuation: api.LineContents_CONTINUATION_HARD_EOL.Enum(),
+	}
+	if l.soft {
+		lc.Continuation = api.LineContents_CONTINUATION_SOFT_EOL.Enum()
+	}
+	var text []rune
+	for _, c := range l.cells {
+		rs := []rune(c)
+		text = append(text, rs...)
+		n := int32(len(rs))
+		if last := len(lc.CodePointsPerCell) - 1; last >= 0 && lc.CodePointsPerCell[last].GetNumCodePoints() == n {
+			lc.CodePointsPerCell[last].Repeats = i32(lc.CodePointsPerCell[last].GetRepeats() + 1)
+			continue
+		}
+		lc.CodePointsPerCell = append(lc.CodePointsPerCell, &api.CodePointsPerCell{
+			NumCodePoints: i32(n),
+			Repeats:       i32(1),
+		})
+	}
+	lc.Text = str(string(text))
+	return lc
+}
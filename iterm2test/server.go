@@ -0,0 +1,286 @@
+// Package iterm2test provides an in-process stand-in for iTerm2 that
+// speaks the same websocket protocol. It keeps an in-memory model of
+// windows, tabs, split panes and sessions so that code built on this
+// module can be exercised without a Mac running iTerm2.
+//
+// This Package is EXPERIMENTAL and only implements the subset of
+// the protocol that the rest of this module relies on.
+package iterm2test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// Cookie is the cookie a Server accepts from its clients.
+const Cookie = "iterm2test"
+
+// ProtocolVersion is the protocol version that
+// the server reports during the handshake.
+const ProtocolVersion = "1.9"
+
+// Handler lets a test take over a request before the Server's
+// model sees it. Returning nil hands the request back to the model.
+type Handler func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage
+
+// Server is a fake iTerm2. It must be created with NewServer
+// and closed with Close.
+type Server struct {
+	// URL is the websocket endpoint of the server,
+	// for example ws://127.0.0.1:49152.
+	URL string
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu         sync.Mutex
+	conns      map[*conn]bool
+	handlers   []Handler
+	requests   []*api.ClientOriginatedMessage
+	profiles   map[string]bool
+	windows    []*window
+	sessions   map[string]*session
+	tabs       map[string]*tab
+	appVars    map[string]string
+	active     *session
+	nextID     int
+	nextNumber int32
+	// tx is the connection in a transaction, if any. Like iTerm2's
+	// main loop, the model serves no one else until it ends.
+	tx     *conn
+	txDone *sync.Cond
+}
+
+// NewServer starts a fake iTerm2 listening on a local port.
+// It starts without any windows.
+func NewServer() *Server {
+	s := &Server{
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{"api.iterm2.com"},
+			// Clients identify themselves with a fixed
+			// ws://localhost/ origin just like with iTerm2.
+			CheckOrigin: func(*http.Request) bool { return true },
+		},
+		conns:    make(map[*conn]bool),
+		profiles: map[string]bool{"Default": true},
+		sessions: make(map[string]*session),
+		tabs:     make(map[string]*tab),
+		appVars:  make(map[string]string),
+	}
+	s.txDone = sync.NewCond(&s.mu)
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+	return s
+}
+
+// Options returns the client options needed to connect to s.
+func (s *Server) Options() client.Options {
+	return client.Options{
+		URL:  s.URL,
+		Auth: []client.Authenticator{client.StaticAuth{Cookie: Cookie}},
+	}
+}
+
+// Close shuts down the server and all of its connections.
+func (s *Server) Close() {
+	s.DropConnections()
+	s.srv.Close()
+}
+
+// DropConnections abruptly closes every open client connection,
+// the way a quitting iTerm2 would.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.ws.Close()
+	}
+}
+
+// Handle registers h to see every request before the model does.
+// Handlers run in the order they were registered.
+func (s *Server) Handle(h Handler) {
+	s.mu.Lock()
+	s.handlers = append(s.handlers, h)
+	s.mu.Unlock()
+}
+
+// Requests returns every request the server has received so far.
+func (s *Server) Requests() []*api.ClientOriginatedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*api.ClientOriginatedMessage(nil), s.requests...)
+}
+
+// AddProfile makes name a valid profile_name for
+// CreateTab and SplitPane requests.
+func (s *Server) AddProfile(name string) {
+	s.mu.Lock()
+	s.profiles[name] = true
+	s.mu.Unlock()
+}
+
+// Notify sends n to every connection that subscribed to it and
+// returns how many connections it was delivered to.
+func (s *Server) Notify(n *api.Notification) int {
+	var count int
+	for _, c := range s.subscribers(n) {
+		if c.send(&api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_Notification{Notification: n},
+		}) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) subscribers(n *api.Notification) []*conn {
+	typ, sess := notificationTarget(n)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*conn
+	for c := range s.conns {
+		for sub := range c.subs {
+			if sub.typ == typ && (sub.session == sess || sess == "" || isWildcard(sub.session)) {
+				list = append(list, c)
+				break
+			}
+		}
+	}
+	return list
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("x-iterm2-cookie") != Cookie {
+		http.Error(w, "bad cookie", http.StatusUnauthorized)
+		return
+	}
+	ws, err := s.upgrader.Upgrade(w, r, http.Header{
+		"X-Iterm2-Protocol-Version": {ProtocolVersion},
+	})
+	if err != nil {
+		return
+	}
+	c := &conn{ws: ws, subs: make(map[subscription]bool)}
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		if s.tx == c {
+			s.tx = nil
+			s.txDone.Broadcast()
+		}
+		s.mu.Unlock()
+		ws.Close()
+	}()
+	for {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req api.ClientOriginatedMessage
+		if err := proto.Unmarshal(msg, &req); err != nil {
+			return
+		}
+		resp, notes := s.serve(c, &req)
+		resp.Id = req.Id
+		if err := c.send(resp); err != nil {
+			return
+		}
+		for _, n := range notes {
+			s.Notify(n)
+		}
+	}
+}
+
+// serve answers a single request and returns the notifications
+// that the request caused, to be sent after the response.
+func (s *Server) serve(c *conn, req *api.ClientOriginatedMessage) (*api.ServerOriginatedMessage, []*api.Notification) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	handlers := append([]Handler(nil), s.handlers...)
+	s.mu.Unlock()
+	for _, h := range handlers {
+		if resp := h(req); resp != nil {
+			return resp, nil
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.tx != nil && s.tx != c {
+		s.txDone.Wait()
+	}
+	return s.handle(c, req)
+}
+
+// conn is a single client connection.
+type conn struct {
+	ws  *websocket.Conn
+	wmu sync.Mutex
+	// subs is guarded by Server.mu.
+	subs map[subscription]bool
+}
+
+type subscription struct {
+	typ     api.NotificationType
+	session string
+}
+
+func (c *conn) send(msg *api.ServerOriginatedMessage) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.ws.WriteMessage(websocket.BinaryMessage, b)
+}
+
+func notificationTarget(n *api.Notification) (api.NotificationType, string) {
+	switch {
+	case n.KeystrokeNotification != nil:
+		return api.NotificationType_NOTIFY_ON_KEYSTROKE, n.GetKeystrokeNotification().GetSession()
+	case n.ScreenUpdateNotification != nil:
+		return api.NotificationType_NOTIFY_ON_SCREEN_UPDATE, n.GetScreenUpdateNotification().GetSession()
+	case n.PromptNotification != nil:
+		return api.NotificationType_NOTIFY_ON_PROMPT, n.GetPromptNotification().GetSession()
+	case n.LocationChangeNotification != nil:
+		return api.NotificationType_NOTIFY_ON_LOCATION_CHANGE, n.GetLocationChangeNotification().GetSession()
+	case n.CustomEscapeSequenceNotification != nil:
+		return api.NotificationType_NOTIFY_ON_CUSTOM_ESCAPE_SEQUENCE, n.GetCustomEscapeSequenceNotification().GetSession()
+	case n.NewSessionNotification != nil:
+		return api.NotificationType_NOTIFY_ON_NEW_SESSION, ""
+	case n.TerminateSessionNotification != nil:
+		return api.NotificationType_NOTIFY_ON_TERMINATE_SESSION, ""
+	case n.LayoutChangedNotification != nil:
+		return api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE, ""
+	case n.FocusChangedNotification != nil:
+		return api.NotificationType_NOTIFY_ON_FOCUS_CHANGE, ""
+	case n.ServerOriginatedRpcNotification != nil:
+		return api.NotificationType_NOTIFY_ON_SERVER_ORIGINATED_RPC, ""
+	case n.BroadcastDomainsChanged != nil:
+		return api.NotificationType_NOTIFY_ON_BROADCAST_CHANGE, ""
+	case n.VariableChangedNotification != nil:
+		return api.NotificationType_NOTIFY_ON_VARIABLE_CHANGE, ""
+	case n.ProfileChangedNotification != nil:
+		return api.NotificationType_NOTIFY_ON_PROFILE_CHANGE, ""
+	}
+	return 0, ""
+}
+
+func isWildcard(session string) bool {
+	return session == "" || session == "all" || session == "active"
+}
@@ -0,0 +1,167 @@
+package iterm2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// Lookups that match nothing fail with an error that matches
+// client.ErrNotFound, like requests that iTerm2 answers with a
+// NOT_FOUND status.
+
+func (a *app) SessionByID(id string) (Session, error) {
+	return a.SessionByIDContext(context.Background(), id)
+}
+
+func (a *app) SessionByIDContext(ctx context.Context, id string) (Session, error) {
+	snap, err := a.SnapshotContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Session(id) == nil {
+		return nil, fmt.Errorf("session %q: %w", id, client.ErrNotFound)
+	}
+	return &session{c: a.c, id: id}, nil
+}
+
+func (a *app) TabByID(id string) (Tab, error) {
+	return a.TabByIDContext(context.Background(), id)
+}
+
+func (a *app) TabByIDContext(ctx context.Context, id string) (Tab, error) {
+	snap, err := a.SnapshotContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t := snap.Tab(id)
+	if t == nil {
+		return nil, fmt.Errorf("tab %q: %w", id, client.ErrNotFound)
+	}
+	return &tab{c: a.c, id: t.ID, windowID: t.Window.ID}, nil
+}
+
+func (a *app) WindowByNumber(number int) (Window, error) {
+	return a.WindowByNumberContext(context.Background(), number)
+}
+
+func (a *app) WindowByNumberContext(ctx context.Context, number int) (Window, error) {
+	snap, err := a.SnapshotContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range snap.Windows {
+		if w.Number == number {
+			return &window{c: a.c, id: w.ID}, nil
+		}
+	}
+	return nil, fmt.Errorf("window number %d: %w", number, client.ErrNotFound)
+}
+
+// SessionQuery is what the predicate of FindSessions looks
+// at: a session's place in the layout and its variables.
+type SessionQuery struct {
+	*SessionInfo
+
+	ctx  context.Context
+	c    *client.Client
+	vars map[string]string
+	err  error
+}
+
+// Var returns the value of one of the session's variables, such as
+// "jobName", "path" or "user.project". Strings are returned as is
+// and other values as JSON. Unset variables are empty. Variables
+// are only fetched from iTerm2 once they are asked for.
+func (q *SessionQuery) Var(name string) string {
+	if v, ok := q.vars[name]; ok {
+		return v
+	}
+	if q.err != nil {
+		return ""
+	}
+	resp, err := q.c.Variable(q.ctx, &api.VariableRequest{
+		Scope: &api.VariableRequest_SessionId{SessionId: q.ID},
+		Get:   []string{name},
+	})
+	if err == nil {
+		err = client.CheckStatus("VariableRequest", q.ID, resp.GetStatus())
+	}
+	if err != nil {
+		q.err = fmt.Errorf("could not get variable %q of session %q: %w", name, q.ID, err)
+		return ""
+	}
+	var v string
+	if values := resp.GetValues(); len(values) > 0 {
+		v = decodeVar(values[0])
+	}
+	if q.vars == nil {
+		q.vars = map[string]string{}
+	}
+	q.vars[name] = v
+	return v
+}
+
+// decodeVar turns a JSON encoded variable into a string.
+func decodeVar(raw string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return raw
+	}
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	return raw
+}
+
+func (a *app) FindSessions(match func(q *SessionQuery) bool) ([]Session, error) {
+	return a.FindSessionsContext(context.Background(), match)
+}
+
+// FindSessionsContext returns every session, buried ones included,
+// that match reports true for, in layout order.
+func (a *app) FindSessionsContext(ctx context.Context, match func(q *SessionQuery) bool) ([]Session, error) {
+	snap, err := a.SnapshotContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := []Session{}
+	for _, si := range snap.Sessions() {
+		q := &SessionQuery{SessionInfo: si, ctx: ctx, c: a.c}
+		ok := match(q)
+		if q.err != nil {
+			return nil, q.err
+		}
+		if ok {
+			list = append(list, &session{c: a.c, id: si.ID})
+		}
+	}
+	return list, nil
+}
+
+func (a *app) CurrentSession() (Session, error) {
+	return a.CurrentSessionContext(context.Background())
+}
+
+// CurrentSessionContext returns the session that the program runs
+// in, according to the ITERM_SESSION_ID environment variable that
+// iTerm2 sets in every session as w0t0p0:UUID.
+func (a *app) CurrentSessionContext(ctx context.Context) (Session, error) {
+	env := os.Getenv("ITERM_SESSION_ID")
+	if env == "" {
+		return nil, fmt.Errorf("ITERM_SESSION_ID is not set: %w", client.ErrNotFound)
+	}
+	id := env
+	if i := strings.IndexByte(env, ':'); i >= 0 {
+		id = env[i+1:]
+	}
+	return a.SessionByIDContext(ctx, id)
+}
@@ -0,0 +1,21 @@
+package iterm2_test
+
+import (
+	"errors"
+	"testing"
+
+	"marwan.io/iterm2/client"
+)
+
+func TestLookupNotFound(t *testing.T) {
+	app, _ := newApp(t)
+	if _, err := app.SessionByID("missing"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("SessionByID: expected client.ErrNotFound but got %v", err)
+	}
+	if _, err := app.TabByID("missing"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("TabByID: expected client.ErrNotFound but got %v", err)
+	}
+	if _, err := app.WindowByNumber(42); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("WindowByNumber: expected client.ErrNotFound but got %v", err)
+	}
+}
@@ -0,0 +1,358 @@
+package iterm2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// ChangeKind tells what caused a Change.
+type ChangeKind int
+
+// The kinds of changes a Model reports.
+const (
+	// LayoutChanged is reported when windows, tabs or
+	// split panes were added, removed or moved.
+	LayoutChanged ChangeKind = iota + 1
+	SessionCreated
+	SessionTerminated
+	FocusChanged
+	// Resynced is reported after the model listed every
+	// session again because it may have missed an event.
+	Resynced
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case LayoutChanged:
+		return "layout changed"
+	case SessionCreated:
+		return "session created"
+	case SessionTerminated:
+		return "session terminated"
+	case FocusChanged:
+		return "focus changed"
+	case Resynced:
+		return "resynced"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a single update of a Model.
+type Change struct {
+	Kind ChangeKind
+	// SessionID is the session that was created,
+	// terminated or became active, if any.
+	SessionID string
+	// Snapshot and Focus are the state of the
+	// model once the change was applied.
+	Snapshot *Snapshot
+	Focus    Focus
+}
+
+// Focus is what has the keyboard focus in iTerm2. Its fields
+// are empty until iTerm2 reports a change of focus.
+type Focus struct {
+	AppActive bool
+	// Window is the key window, if any.
+	Window string
+	// Tab is the most recently selected tab.
+	Tab string
+	// Session is the most recently activated session.
+	Session string
+}
+
+// Model is a cached copy of iTerm2's windows, tabs and sessions.
+// It follows layout, session and focus notifications to answer
+// structural queries without asking iTerm2, and lists every
+// session again whenever it may have missed an event, such
+// as after a reconnect.
+type Model struct {
+	a      *app
+	notes  chan *api.Notification
+	resync chan struct{}
+	// ctx is done once the model is closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+	subs   []*client.Subscription
+	worker sync.WaitGroup
+	// unobserve stops following the connection state.
+	unobserve func()
+	// pending holds what notifications said about sessions and tabs
+	// that the layout did not reflect yet: whether each of them
+	// should exist. Only the goroutine running run uses it.
+	pending map[string]bool
+
+	mu        sync.Mutex
+	snap      *Snapshot
+	focus     Focus
+	observers []*changeObserver
+	closed    bool
+}
+
+// changeObserver wraps a func registered with OnChange
+// so that it can be told apart from the others.
+type changeObserver struct {
+	fn func(Change)
+}
+
+// modelNotifications are the notifications a Model follows.
+var modelNotifications = []api.NotificationType{
+	api.NotificationType_NOTIFY_ON_LAYOUT_CHANGE,
+	api.NotificationType_NOTIFY_ON_NEW_SESSION,
+	api.NotificationType_NOTIFY_ON_TERMINATE_SESSION,
+	api.NotificationType_NOTIFY_ON_FOCUS_CHANGE,
+}
+
+// Model subscribes to the notifications that keep a cached copy of
+// iTerm2's layout up to date and returns it once it is populated.
+// The model must be closed when no longer needed.
+func (a *app) Model(ctx context.Context) (*Model, error) {
+	m := &Model{
+		a:      a,
+		notes:  make(chan *api.Notification),
+		resync: make(chan struct{}, 1),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	// Subscribed before listing so that no change can slip in
+	// between the two, and as one so that notifications of
+	// different kinds arrive in the order iTerm2 sent them.
+	reqs := make([]*api.NotificationRequest, 0, len(modelNotifications))
+	for _, typ := range modelNotifications {
+		reqs = append(reqs, &api.NotificationRequest{NotificationType: typ.Enum()})
+	}
+	subs, err := a.c.SubscribeMany(ctx, reqs, func(n *api.Notification) {
+		select {
+		case m.notes <- n:
+		case <-m.ctx.Done():
+		}
+	})
+	if err != nil {
+		m.Close()
+		return nil, fmt.Errorf("could not subscribe to layout changes: %w", err)
+	}
+	m.subs = subs
+	snap, err := a.SnapshotContext(ctx)
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	m.snap = snap
+	m.unobserve = a.c.OnStateChange(func(s client.ConnState) {
+		if s == client.StateConnected {
+			m.requestResync()
+		}
+	})
+	m.worker.Add(1)
+	go m.run()
+	return m, nil
+}
+
+// Snapshot returns the current state of the model.
+func (m *Model) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snap
+}
+
+// Focus returns what currently has the keyboard focus.
+func (m *Model) Focus() Focus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.focus
+}
+
+// Windows returns the windows of the current state without asking
+// iTerm2 for them. Only the list comes from the model: the methods
+// of each Window, such as ListTabs, still ask iTerm2. Use Snapshot
+// to read the whole layout from the model.
+func (m *Model) Windows() []Window {
+	list := []Window{}
+	for _, w := range m.Snapshot().Windows {
+		list = append(list, &window{c: m.a.c, id: w.ID})
+	}
+	return list
+}
+
+// OnChange registers fn to be called after every change of the
+// model. fn is called from the goroutine that keeps the model up
+// to date and therefore must not block or close the model.
+// The returned func unregisters fn.
+func (m *Model) OnChange(fn func(Change)) (remove func()) {
+	o := &changeObserver{fn: fn}
+	m.mu.Lock()
+	m.observers = append(m.observers, o)
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, other := range m.observers {
+			if other == o {
+				m.observers = append(m.observers[:i:i], m.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Close stops following iTerm2's notifications.
+// The model keeps its last state. Close gives up
+// on iTerm2 if it does not answer in time.
+func (m *Model) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	m.mu.Unlock()
+	if m.unobserve != nil {
+		m.unobserve()
+	}
+	m.cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	var firstErr error
+	for _, s := range m.subs {
+		err := s.Unsubscribe(ctx)
+		if err != nil && !errors.Is(err, client.ErrClosed) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	m.worker.Wait()
+	return firstErr
+}
+
+func (m *Model) requestResync() {
+	select {
+	case m.resync <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Model) run() {
+	defer m.worker.Done()
+	for {
+		select {
+		case n := <-m.notes:
+			m.apply(n)
+		case <-m.resync:
+			m.relist()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// apply updates the model with a single notification. iTerm2 reports
+// new sessions, terminated ones and changes of focus before the layout
+// change that goes with them, so what they say about sessions and tabs
+// is checked against the next layout. If it does not agree, something
+// was missed, in which case the whole state is listed again.
+func (m *Model) apply(n *api.Notification) {
+	m.mu.Lock()
+	snap, focus := m.snap, m.focus
+	m.mu.Unlock()
+	ch := Change{Snapshot: snap, Focus: focus}
+	switch {
+	case n.GetLayoutChangedNotification() != nil:
+		ch.Kind = LayoutChanged
+		ch.Snapshot = newSnapshot(n.GetLayoutChangedNotification().GetListSessionsResponse())
+		if !m.reconcile(ch.Snapshot) {
+			m.requestResync()
+		}
+	case n.GetNewSessionNotification() != nil:
+		ch.Kind = SessionCreated
+		ch.SessionID = n.GetNewSessionNotification().GetSessionId()
+		if snap.Session(ch.SessionID) == nil {
+			m.expect(ch.SessionID, true)
+		}
+	case n.GetTerminateSessionNotification() != nil:
+		ch.Kind = SessionTerminated
+		ch.SessionID = n.GetTerminateSessionNotification().GetSessionId()
+		if snap.Session(ch.SessionID) != nil {
+			m.expect(ch.SessionID, false)
+		}
+	case n.GetFocusChangedNotification() != nil:
+		ch.Kind = FocusChanged
+		fc := n.GetFocusChangedNotification()
+		switch e := fc.GetEvent().(type) {
+		case *api.FocusChangedNotification_ApplicationActive:
+			ch.Focus.AppActive = e.ApplicationActive
+		case *api.FocusChangedNotification_Window_:
+			switch e.Window.GetWindowStatus() {
+			case api.FocusChangedNotification_Window_TERMINAL_WINDOW_BECAME_KEY,
+				api.FocusChangedNotification_Window_TERMINAL_WINDOW_IS_CURRENT:
+				ch.Focus.Window = e.Window.GetWindowId()
+			case api.FocusChangedNotification_Window_TERMINAL_WINDOW_RESIGNED_KEY:
+				if ch.Focus.Window == e.Window.GetWindowId() {
+					ch.Focus.Window = ""
+				}
+			}
+		case *api.FocusChangedNotification_SelectedTab:
+			ch.Focus.Tab = e.SelectedTab
+			if snap.Tab(e.SelectedTab) == nil {
+				m.expect(e.SelectedTab, true)
+			}
+		case *api.FocusChangedNotification_Session:
+			ch.SessionID = e.Session
+			ch.Focus.Session = e.Session
+			if snap.Session(e.Session) == nil {
+				m.expect(e.Session, true)
+			}
+		}
+	default:
+		return
+	}
+	m.update(ch)
+}
+
+// expect records that the session or tab with the
+// given id should exist, or not, in the next layout.
+func (m *Model) expect(id string, exists bool) {
+	if m.pending == nil {
+		m.pending = map[string]bool{}
+	}
+	m.pending[id] = exists
+}
+
+// reconcile reports whether snap agrees with
+// what was expected of it and forgets about it.
+func (m *Model) reconcile(snap *Snapshot) bool {
+	ok := true
+	for id, exists := range m.pending {
+		found := snap.Session(id) != nil || snap.Tab(id) != nil
+		if found != exists {
+			ok = false
+		}
+	}
+	m.pending = nil
+	return ok
+}
+
+func (m *Model) relist() {
+	snap, err := m.a.SnapshotContext(m.ctx)
+	if err != nil {
+		// Either the model was closed or the connection
+		// is down and the reconnect will ask for another
+		// resync.
+		return
+	}
+	m.pending = nil
+	m.update(Change{Kind: Resynced, Snapshot: snap, Focus: m.Focus()})
+}
+
+func (m *Model) update(ch Change) {
+	m.mu.Lock()
+	m.snap = ch.Snapshot
+	m.focus = ch.Focus
+	observers := append([]*changeObserver{}, m.observers...)
+	m.mu.Unlock()
+	for _, o := range observers {
+		o.fn(ch)
+	}
+}
@@ -0,0 +1,131 @@
+package iterm2_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"marwan.io/iterm2"
+	"marwan.io/iterm2/api"
+)
+
+func TestModelFollowsServerOrder(t *testing.T) {
+	app, _ := newApp(t)
+	w, err := app.CreateWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := app.Model(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	changes := make(chan iterm2.Change, 100)
+	m.OnChange(func(ch iterm2.Change) { changes <- ch })
+	const tabs = 3
+	for i := 0; i < tabs; i++ {
+		if _, err := w.CreateTab(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every new session is announced before the layout that shows it.
+	for i := 0; i < tabs; i++ {
+		created := nextChange(t, changes)
+		if created.Kind != iterm2.SessionCreated {
+			t.Fatalf("expected %v but got %v", iterm2.SessionCreated, created.Kind)
+		}
+		layout := nextChange(t, changes)
+		if layout.Kind != iterm2.LayoutChanged {
+			t.Fatalf("expected %v but got %v", iterm2.LayoutChanged, layout.Kind)
+		}
+		if layout.Snapshot.Session(created.SessionID) == nil {
+			t.Fatalf("layout is missing new session %q", created.SessionID)
+		}
+	}
+	select {
+	case ch := <-changes:
+		t.Fatalf("unexpected change: %v", ch.Kind)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if got := len(m.Snapshot().Windows[0].Tabs); got != tabs+1 {
+		t.Fatalf("expected %d tabs but got %d", tabs+1, got)
+	}
+}
+
+func nextChange(t *testing.T, changes <-chan iterm2.Change) iterm2.Change {
+	t.Helper()
+	select {
+	case ch := <-changes:
+		return ch
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a change")
+	}
+	return iterm2.Change{}
+}
+
+func TestModelOnChangeRemove(t *testing.T) {
+	app, _ := newApp(t)
+	m, err := app.Model(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	var removed int32
+	remove := m.OnChange(func(iterm2.Change) { atomic.AddInt32(&removed, 1) })
+	remove()
+	changes := make(chan iterm2.Change, 100)
+	m.OnChange(func(ch iterm2.Change) { changes <- ch })
+	if _, err := app.CreateWindow(); err != nil {
+		t.Fatal(err)
+	}
+	nextChange(t, changes)
+	if n := atomic.LoadInt32(&removed); n != 0 {
+		t.Fatalf("removed observer was called %d times", n)
+	}
+}
+
+func TestModelCloseUnresponsive(t *testing.T) {
+	defer iterm2.SetCleanupTimeout(50 * time.Millisecond)()
+	app, srv := newApp(t)
+	// Once frozen, iTerm2 stops answering: the model's
+	// resync after the reconnect never gets its sessions.
+	var frozen int32
+	listing := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if atomic.LoadInt32(&frozen) == 1 && req.GetListSessionsRequest() != nil {
+			select {
+			case listing <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+		return nil
+	})
+	m, err := app.Model(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&frozen, 1)
+	srv.DropConnections()
+	select {
+	case <-listing:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the model to resync")
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- m.Close() }()
+	select {
+	case err := <-closed:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a deadline error but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hung on an unresponsive iTerm2")
+	}
+}
@@ -0,0 +1,119 @@
+package iterm2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"marwan.io/iterm2/api"
+)
+
+// SessionOptions customize the session that a new
+// window, tab or split pane starts with.
+type SessionOptions struct {
+	// Profile is the name of the profile to use.
+	// Defaults to the default profile.
+	Profile string
+
+	// Directory, if set, is the initial working directory.
+	Directory string
+
+	// Command, if set, runs instead of the profile's command.
+	Command string
+
+	// ProfileProperties override properties of the profile for the
+	// new session only, keyed by their names in the profile, such as
+	// "Badge Text". Values are encoded as JSON.
+	ProfileProperties map[string]interface{}
+}
+
+// CreateWindowOptions for customizing a new window.
+type CreateWindowOptions struct {
+	SessionOptions
+}
+
+// CreateTabOptions for customizing a new tab.
+type CreateTabOptions struct {
+	SessionOptions
+
+	// Index, if set, is the position of the new tab in its
+	// window. An invalid index still creates the tab, at the
+	// end, along with an ErrInvalidTabIndex error.
+	Index *int
+}
+
+// SplitDirection tells how a pane is split.
+type SplitDirection int
+
+// The directions a pane can be split in.
+const (
+	// SplitHorizontal puts the new pane below,
+	// or above, the one being split.
+	SplitHorizontal SplitDirection = iota + 1
+	// SplitVertical puts the new pane to the right,
+	// or left, of the one being split.
+	SplitVertical
+)
+
+// SplitPaneOptions for customizing the new pane session.
+type SplitPaneOptions struct {
+	SessionOptions
+
+	// Direction of the split. Defaults to SplitHorizontal
+	// unless Vertical is set.
+	Direction SplitDirection
+
+	// Vertical splits the pane vertically.
+	//
+	// Deprecated: use Direction.
+	Vertical bool
+
+	// Before puts the new pane above or to the left
+	// of the split one instead of below or to the right.
+	Before bool
+}
+
+func (o SplitPaneOptions) direction() *api.SplitPaneRequest_SplitDirection {
+	if o.Direction == SplitVertical || o.Direction == 0 && o.Vertical {
+		return api.SplitPaneRequest_VERTICAL.Enum()
+	}
+	return api.SplitPaneRequest_HORIZONTAL.Enum()
+}
+
+// profileName returns the profile name to request, if any.
+func (o SessionOptions) profileName() *string {
+	if o.Profile == "" {
+		return nil
+	}
+	return str(o.Profile)
+}
+
+// properties encodes the profile customizations of o.
+func (o SessionOptions) properties() ([]*api.ProfileProperty, error) {
+	props := make(map[string]interface{}, len(o.ProfileProperties)+4)
+	for k, v := range o.ProfileProperties {
+		props[k] = v
+	}
+	if o.Directory != "" {
+		props["Custom Directory"] = "Yes"
+		props["Working Directory"] = o.Directory
+	}
+	if o.Command != "" {
+		props["Custom Command"] = "Yes"
+		props["Command"] = o.Command
+	}
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var list []*api.ProfileProperty
+	for _, k := range keys {
+		v, err := json.Marshal(props[k])
+		if err != nil {
+			return nil, fmt.Errorf("could not encode profile property %q: %w", k, err)
+		}
+		list = append(list, &api.ProfileProperty{Key: str(k), JsonValue: str(string(v))})
+	}
+	return list, nil
+}
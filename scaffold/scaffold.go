@@ -8,6 +8,7 @@
 package scaffold
 
 import (
+	"context"
 	"fmt"
 
 	"golang.org/x/sync/errgroup"
@@ -23,6 +24,12 @@ type WindowSpec struct {
 // Run takes a window spec and creates a new iTerm2 session and uses it
 // to create a new window with the given specs.
 func Run(appName string, w WindowSpec) error {
+	return RunContext(context.Background(), appName, w)
+}
+
+// RunContext is like Run but aborts any pending iTerm2 call
+// once ctx is done.
+func RunContext(ctx context.Context, appName string, w WindowSpec) error {
 	if w.Title == "" {
 		return fmt.Errorf("window must have a title")
 	}
@@ -34,11 +41,24 @@ func Run(appName string, w WindowSpec) error {
 		return fmt.Errorf("iterm2.NewApp: %w", err)
 	}
 	defer app.Close()
-	window, err := app.CreateWindow()
+	return RunWithApp(ctx, app, w)
+}
+
+// RunWithApp is like RunContext but uses an already
+// connected app instead of establishing its own connection.
+// The app is left open.
+func RunWithApp(ctx context.Context, app iterm2.App, w WindowSpec) error {
+	if w.Title == "" {
+		return fmt.Errorf("window must have a title")
+	}
+	if len(w.Tabs) == 0 {
+		return fmt.Errorf("window must have at least 1 tab")
+	}
+	window, err := app.CreateWindowContext(ctx)
 	if err != nil {
 		return fmt.Errorf("app.CreateWindow: %w", err)
 	}
-	err = window.SetTitle(w.Title)
+	err = window.SetTitleContext(ctx, w.Title)
 	if err != nil {
 		return fmt.Errorf("window.SetTitle: %w", err)
 	}
@@ -46,58 +66,58 @@ func Run(appName string, w WindowSpec) error {
 	for i, ts := range w.Tabs {
 		var tab iterm2.Tab
 		if i == 0 {
-			tabs, err := window.ListTabs()
+			tabs, err := window.ListTabsContext(ctx)
 			if err != nil {
 				return fmt.Errorf("window.ListTabs: %w", err)
 			}
 			tab = tabs[0]
 		} else {
-			tab, err = window.CreateTab()
+			tab, err = window.CreateTabContext(ctx)
 			if err != nil {
 				return fmt.Errorf("window.CreateTab: %w", err)
 			}
 		}
 		ts := ts
-		eg.Go(func() error { return createTab(tab, ts) })
+		eg.Go(func() error { return createTab(ctx, tab, ts) })
 	}
 	err = eg.Wait()
 	if err != nil {
 		return fmt.Errorf("createTab: %w", err)
 	}
-	windowTabs, err := window.ListTabs()
+	windowTabs, err := window.ListTabsContext(ctx)
 	if err != nil {
 		return err
 	}
-	ss, err := windowTabs[0].ListSessions()
+	ss, err := windowTabs[0].ListSessionsContext(ctx)
 	if err != nil {
 		return fmt.Errorf("first tab sessions: %w", err)
 	}
-	err = ss[0].Activate(true, true)
+	err = ss[0].ActivateContext(ctx, true, true)
 	if err != nil {
 		return fmt.Errorf("session.Activate: %w", err)
 	}
 	return nil
 }
 
-func createTab(tab iterm2.Tab, ts TabSpec) error {
-	err := tab.SetTitle(ts.Title)
+func createTab(ctx context.Context, tab iterm2.Tab, ts TabSpec) error {
+	err := tab.SetTitleContext(ctx, ts.Title)
 	if err != nil {
 		return fmt.Errorf("tab.SetTitle: %w", err)
 	}
-	sessions, err := tab.ListSessions()
+	sessions, err := tab.ListSessionsContext(ctx)
 	if err != nil {
 		return fmt.Errorf("tab.ListSessions: %w", err)
 	}
 	sesh := sessions[0]
 	if ts.Dir != "" {
-		err = sesh.SendText(fmt.Sprintf("cd %v\n", ts.Dir))
+		err = sesh.SendTextContext(ctx, fmt.Sprintf("cd %v\n", ts.Dir))
 		if err != nil {
 			return fmt.Errorf("error changing directory: %w", err)
 		}
 	}
 	if ts.Env != nil {
 		for _, e := range ts.Env.GetEnv() {
-			err = sesh.SendText(fmt.Sprintf("export %s\n", e))
+			err = sesh.SendTextContext(ctx, fmt.Sprintf("export %s\n", e))
 			if err != nil {
 				return fmt.Errorf("error exporting env: %w", err)
 			}
@@ -110,8 +130,8 @@ func createTab(tab iterm2.Tab, ts TabSpec) error {
 		}
 	}
 	if ts.Pane != nil {
-		pane, err := sesh.SplitPane(iterm2.SplitPaneOptions{
-			Vertical: true,
+		pane, err := sesh.SplitPaneContext(ctx, iterm2.SplitPaneOptions{
+			Direction: iterm2.SplitVertical,
 		})
 		if err != nil {
 			return fmt.Errorf("sesh.SplitPane: %w", err)
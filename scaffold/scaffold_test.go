@@ -0,0 +1,115 @@
+package scaffold_test
+
+import (
+	"context"
+	"testing"
+
+	"marwan.io/iterm2"
+	"marwan.io/iterm2/iterm2test"
+	"marwan.io/iterm2/scaffold"
+)
+
+func TestRunWithApp(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	app, err := iterm2.NewAppWithOptions("scaffold", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	var created, paned iterm2.Session
+	err = scaffold.RunWithApp(context.Background(), app, scaffold.WindowSpec{
+		Title: "dev",
+		Tabs: []scaffold.TabSpec{
+			{
+				Title: "api",
+				Dir:   "/src/api",
+				Env:   scaffold.Env{"PORT=8080"},
+				OnCreate: func(s iterm2.Session) error {
+					created = s
+					return s.SendText("go run .\n")
+				},
+				Pane: &scaffold.PaneSpec{
+					OnCreate: func(s iterm2.Session) error {
+						paned = s
+						return s.SendText("tail -f log\n")
+					},
+				},
+			},
+			{Title: "db"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := app.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.Windows) != 1 {
+		t.Fatalf("expected 1 window but got %d", len(snap.Windows))
+	}
+	w := snap.Windows[0]
+	if got := srv.Title(w.ID); got != "dev" {
+		t.Fatalf("expected window title %q but got %q", "dev", got)
+	}
+	if len(w.Tabs) != 2 {
+		t.Fatalf("expected 2 tabs but got %d", len(w.Tabs))
+	}
+	for i, title := range []string{"api", "db"} {
+		if got := srv.Title(w.Tabs[i].ID); got != title {
+			t.Fatalf("expected tab %d title %q but got %q", i, title, got)
+		}
+	}
+
+	api := w.Tabs[0]
+	if !api.Root.Vertical {
+		t.Fatal("expected the api tab to be split vertically")
+	}
+	sessions := api.Sessions()
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions in the api tab but got %d", len(sessions))
+	}
+	if created.GetSessionID() != sessions[0].ID || paned.GetSessionID() != sessions[1].ID {
+		t.Fatalf("OnCreate got sessions %q and %q, expected %q and %q",
+			created.GetSessionID(), paned.GetSessionID(), sessions[0].ID, sessions[1].ID)
+	}
+	want := "cd /src/api\nexport PORT=8080\ngo run .\n"
+	if got := srv.Input(sessions[0].ID); got != want {
+		t.Fatalf("expected input %q but got %q", want, got)
+	}
+	if got := srv.Input(sessions[1].ID); got != "tail -f log\n" {
+		t.Fatalf("expected pane input %q but got %q", "tail -f log\n", got)
+	}
+	if got := len(w.Tabs[1].Sessions()); got != 1 {
+		t.Fatalf("expected 1 session in the db tab but got %d", got)
+	}
+}
+
+func TestRunWithAppValidatesSpec(t *testing.T) {
+	srv := iterm2test.NewServer()
+	defer srv.Close()
+	app, err := iterm2.NewAppWithOptions("scaffold", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+
+	for _, spec := range []scaffold.WindowSpec{
+		{Tabs: []scaffold.TabSpec{{Title: "untitled window"}}},
+		{Title: "no tabs"},
+	} {
+		if err := scaffold.RunWithApp(context.Background(), app, spec); err == nil {
+			t.Fatalf("expected an error for %+v", spec)
+		}
+	}
+	windows, err := app.ListWindows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 0 {
+		t.Fatalf("expected no window to be created but got %d", len(windows))
+	}
+}
@@ -0,0 +1,124 @@
+package iterm2
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/buffer"
+	"marwan.io/iterm2/client"
+)
+
+// Coord is the position of a cell.
+type Coord = buffer.Coord
+
+// CoordRange is a range of cells.
+type CoordRange = buffer.CoordRange
+
+// Continuation tells how a line ends.
+type Continuation = buffer.Continuation
+
+// The ways a line can end.
+const (
+	HardEOL = buffer.HardEOL
+	SoftEOL = buffer.SoftEOL
+)
+
+// Line is a line of text along with where its text sits on screen.
+type Line = buffer.Line
+
+// ScreenContents are lines read from a session.
+type ScreenContents struct {
+	Lines []Line
+	// Range holds the line numbers of Lines.
+	Range CoordRange
+	// Cursor is the position of the cursor.
+	Cursor Coord
+	// LinesAboveScreen is the number of lines, including those lost
+	// from the scrollback history, that precede the visible screen.
+	LinesAboveScreen int64
+}
+
+func (s *session) Screen() (*ScreenContents, error) {
+	return s.ScreenContext(context.Background())
+}
+
+// ScreenContext returns what is visible on the session's screen.
+func (s *session) ScreenContext(ctx context.Context) (*ScreenContents, error) {
+	return s.getBuffer(ctx, &api.LineRange{ScreenContentsOnly: b(true)})
+}
+
+func (s *session) Tail(n int) (*ScreenContents, error) {
+	return s.TailContext(context.Background(), n)
+}
+
+// TailContext returns the last n lines of the session,
+// reaching back into the scrollback history if needed.
+// A negative n fails with client.ErrInvalidLineRange.
+func (s *session) TailContext(ctx context.Context, n int) (*ScreenContents, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("cannot read the last %d lines of session %q: %w", n, s.id, client.ErrInvalidLineRange)
+	}
+	if n > math.MaxInt32 {
+		n = math.MaxInt32
+	}
+	lines := int32(n)
+	return s.getBuffer(ctx, &api.LineRange{TrailingLines: &lines})
+}
+
+func (s *session) ReadRange(r CoordRange) (*ScreenContents, error) {
+	return s.ReadRangeContext(context.Background(), r)
+}
+
+// ReadRangeContext returns the lines of r that are still available.
+func (s *session) ReadRangeContext(ctx context.Context, r CoordRange) (*ScreenContents, error) {
+	return s.getBuffer(ctx, &api.LineRange{
+		WindowedCoordRange: &api.WindowedCoordRange{CoordRange: coordRangeProto(r)},
+	})
+}
+
+func (s *session) getBuffer(ctx context.Context, lr *api.LineRange) (*ScreenContents, error) {
+	resp, err := s.c.GetBuffer(ctx, &api.GetBufferRequest{
+		Session:   &s.id,
+		LineRange: lr,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading session %q: %w", s.id, err)
+	}
+	if err := client.CheckStatus("GetBufferRequest", s.id, resp.GetStatus()); err != nil {
+		return nil, err
+	}
+	sc := &ScreenContents{
+		Range:            newCoordRange(resp.GetWindowedCoordRange().GetCoordRange()),
+		Cursor:           newCoord(resp.GetCursor()),
+		LinesAboveScreen: resp.GetNumLinesAboveScreen(),
+	}
+	for i, lc := range resp.GetContents() {
+		sc.Lines = append(sc.Lines, buffer.NewLine(sc.Range.Start.Y+int64(i), lc))
+	}
+	return sc, nil
+}
+
+// LogicalLines joins the lines that were soft-wrapped.
+func (sc *ScreenContents) LogicalLines() []*buffer.LogicalLine {
+	return buffer.Join(sc.Lines)
+}
+
+func newCoord(c *api.Coord) Coord {
+	return Coord{X: int(c.GetX()), Y: c.GetY()}
+}
+
+func newCoordRange(r *api.CoordRange) CoordRange {
+	return CoordRange{Start: newCoord(r.GetStart()), End: newCoord(r.GetEnd())}
+}
+
+func coordProto(c Coord) *api.Coord {
+	x := int32(c.X)
+	y := c.Y
+	return &api.Coord{X: &x, Y: &y}
+}
+
+func coordRangeProto(r CoordRange) *api.CoordRange {
+	return &api.CoordRange{Start: coordProto(r.Start), End: coordProto(r.End)}
+}
@@ -0,0 +1,44 @@
+package iterm2_test
+
+import (
+	"errors"
+	"testing"
+
+	"marwan.io/iterm2/client"
+)
+
+func TestTailBounds(t *testing.T) {
+	app, srv := newApp(t)
+	w, err := app.CreateWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tabs, err := w.ListTabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := tabs[0].ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sessions[0]
+	if err := srv.Write(s.GetSessionID(), "one\ntwo\nthree"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Tail(-1); !errors.Is(err, client.ErrInvalidLineRange) {
+		t.Fatalf("expected ErrInvalidLineRange but got %v", err)
+	}
+	maxInt := int(^uint(0) >> 1)
+	sc, err := s.Tail(maxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range sc.Lines {
+		got = append(got, l.Text)
+	}
+	if len(got) != 3 || got[0] != "one" || got[2] != "three" {
+		t.Fatalf("expected every line but got %q", got)
+	}
+}
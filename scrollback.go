@@ -0,0 +1,157 @@
+package iterm2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// DefaultScrollbackPageSize is the number of
+// lines a Scrollback reads per page by default.
+const DefaultScrollbackPageSize = 1000
+
+// Scrollback reads every line of a session, its history followed by
+// its screen, one page at a time. Lines keep their numbers as older
+// ones scroll out of the history, so the lines that are lost while
+// reading are reported as a gap rather than silently skipped:
+//
+//	sb := s.Scrollback()
+//	for sb.Next() {
+//		page := sb.Page()
+//		...
+//	}
+//	if err := sb.Err(); err != nil {
+//		...
+//	}
+type Scrollback struct {
+	// PageSize is the number of lines to read per page.
+	// It may be changed between pages.
+	PageSize int
+
+	s       *session
+	started bool
+	next    int64
+	end     int64
+	page    *ScrollbackPage
+	err     error
+}
+
+// ScrollbackPage is a run of consecutive lines of a session.
+type ScrollbackPage struct {
+	// Gap holds the numbers of the lines that were lost from
+	// the history before they could be read and that come right
+	// before Lines. Gap.Start equals Gap.End if none were lost.
+	Gap   CoordRange
+	Lines []Line
+}
+
+// Lost returns the number of lines in the page's gap.
+func (p *ScrollbackPage) Lost() int64 {
+	return p.Gap.End.Y - p.Gap.Start.Y
+}
+
+// Scrollback returns an iterator over the lines that the session
+// holds once its first page is read. Lines printed afterwards
+// are left out.
+func (s *session) Scrollback() *Scrollback {
+	return &Scrollback{s: s, PageSize: DefaultScrollbackPageSize}
+}
+
+// Next reads the next page and reports whether there was one.
+func (sb *Scrollback) Next() bool {
+	return sb.NextContext(context.Background())
+}
+
+// NextContext reads the next page and reports whether there was one.
+// It returns false once every line was read or an error occurred.
+func (sb *Scrollback) NextContext(ctx context.Context) bool {
+	sb.page = nil
+	if sb.err != nil {
+		return false
+	}
+	if !sb.started {
+		n, err := sb.s.numberOfLines(ctx)
+		if err != nil {
+			sb.err = err
+			return false
+		}
+		sb.started = true
+		sb.next = n.Overflow
+		sb.end = n.Overflow + n.History + n.Grid
+	}
+	if sb.next >= sb.end {
+		return false
+	}
+	size := sb.PageSize
+	if size <= 0 {
+		size = DefaultScrollbackPageSize
+	}
+	to := sb.next + int64(size)
+	if to > sb.end {
+		to = sb.end
+	}
+	sc, err := sb.s.ReadRangeContext(ctx, CoordRange{
+		Start: Coord{Y: sb.next},
+		End:   Coord{Y: to},
+	})
+	if err != nil {
+		sb.err = err
+		return false
+	}
+	page := &ScrollbackPage{
+		Gap:   CoordRange{Start: Coord{Y: sb.next}, End: Coord{Y: sb.next}},
+		Lines: sc.Lines,
+	}
+	if sc.Range.Start.Y > sb.next {
+		page.Gap.End.Y = sc.Range.Start.Y
+	}
+	if sc.Range.End.Y > sb.next {
+		sb.next = sc.Range.End.Y
+	} else {
+		// Nothing is left of the range: it was lost as a whole.
+		page.Gap.End.Y = to
+		sb.next = to
+	}
+	sb.page = page
+	return true
+}
+
+// Page returns the page that the last call to Next read.
+func (sb *Scrollback) Page() *ScrollbackPage {
+	return sb.page
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (sb *Scrollback) Err() error {
+	return sb.err
+}
+
+// numberOfLines is how a session's lines are laid out: Overflow
+// lines were lost from the history, History lines are still in it
+// and Grid lines are on screen.
+type numberOfLines struct {
+	Overflow int64 `json:"overflow"`
+	Grid     int64 `json:"grid"`
+	History  int64 `json:"history"`
+}
+
+func (s *session) numberOfLines(ctx context.Context) (*numberOfLines, error) {
+	resp, err := s.c.GetProperty(ctx, &api.GetPropertyRequest{
+		Identifier: &api.GetPropertyRequest_SessionId{SessionId: s.id},
+		Name:       str("number_of_lines"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get the number of lines of session %q: %w", s.id, err)
+	}
+	if err := client.CheckStatus("GetPropertyRequest", s.id, resp.GetStatus()); err != nil {
+		return nil, err
+	}
+	var n numberOfLines
+	if err := json.Unmarshal([]byte(resp.GetJsonValue()), &n); err != nil {
+		return nil, fmt.Errorf("could not decode the number of lines of session %q: %w", s.id, err)
+	}
+	return &n, nil
+}
@@ -0,0 +1,126 @@
+package iterm2_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"marwan.io/iterm2"
+)
+
+func TestScrollback(t *testing.T) {
+	// Sessions of the fake server have 25 rows, so a history
+	// limit of 75 keeps exactly the 100 lines written first.
+	const initial = 100
+	type page struct {
+		size int
+		// write is the number of lines printed before the page is read.
+		write    int
+		gap      [2]int64
+		first, n int64
+	}
+	tt := []struct {
+		name  string
+		limit int
+		pages []page
+	}{
+		{
+			name: "paging",
+			pages: []page{
+				{size: 30, gap: [2]int64{0, 0}, first: 0, n: 30},
+				{size: 30, gap: [2]int64{30, 30}, first: 30, n: 30},
+				{size: 30, gap: [2]int64{60, 60}, first: 60, n: 30},
+				{size: 30, gap: [2]int64{90, 90}, first: 90, n: 10},
+			},
+		},
+		{
+			name:  "partial gap",
+			limit: 75,
+			pages: []page{
+				{size: 40, gap: [2]int64{0, 0}, first: 0, n: 40},
+				{size: 40, write: 50, gap: [2]int64{40, 50}, first: 50, n: 30},
+				{size: 40, gap: [2]int64{80, 80}, first: 80, n: 20},
+			},
+		},
+		{
+			name:  "page lost entirely",
+			limit: 75,
+			pages: []page{
+				{size: 20, gap: [2]int64{0, 0}, first: 0, n: 20},
+				// Lines 20 to 59 are lost: the gap runs to the
+				// next available line rather than the page's end.
+				{size: 20, write: 60, gap: [2]int64{20, 60}, first: 60, n: 0},
+				{size: 20, gap: [2]int64{60, 60}, first: 60, n: 20},
+				{size: 20, gap: [2]int64{80, 80}, first: 80, n: 20},
+			},
+		},
+		{
+			name: "page size changes",
+			pages: []page{
+				{size: 10, gap: [2]int64{0, 0}, first: 0, n: 10},
+				{size: 50, gap: [2]int64{10, 10}, first: 10, n: 50},
+				{size: 5, gap: [2]int64{60, 60}, first: 60, n: 5},
+				// Zero falls back to the default page size.
+				{size: 0, gap: [2]int64{65, 65}, first: 65, n: 35},
+			},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			app, srv := newApp(t)
+			s := newSession(t, app)
+			id := s.GetSessionID()
+			if err := srv.SetHistoryLimit(id, tc.limit); err != nil {
+				t.Fatal(err)
+			}
+			// Every line holds its own number.
+			var text []string
+			for i := 0; i < initial; i++ {
+				text = append(text, fmt.Sprintf("l%d", i))
+			}
+			if err := srv.Write(id, strings.Join(text, "\n")); err != nil {
+				t.Fatal(err)
+			}
+			written := initial
+
+			sb := s.Scrollback()
+			for i, want := range tc.pages {
+				for j := 0; j < want.write; j++ {
+					if err := srv.Write(id, fmt.Sprintf("\nl%d", written)); err != nil {
+						t.Fatal(err)
+					}
+					written++
+				}
+				sb.PageSize = want.size
+				if !sb.Next() {
+					t.Fatalf("page %d: expected a page but got none: %v", i, sb.Err())
+				}
+				p := sb.Page()
+				gap := [2]int64{p.Gap.Start.Y, p.Gap.End.Y}
+				if gap != want.gap || p.Lost() != want.gap[1]-want.gap[0] {
+					t.Fatalf("page %d: expected gap %v but got %v", i, want.gap, gap)
+				}
+				checkLines(t, i, p.Lines, want.first, want.n)
+			}
+			if sb.Next() {
+				t.Fatalf("expected no more pages but got %+v", sb.Page())
+			}
+			if err := sb.Err(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func checkLines(t *testing.T, page int, lines []iterm2.Line, first, n int64) {
+	t.Helper()
+	if int64(len(lines)) != n {
+		t.Fatalf("page %d: expected %d lines but got %d", page, n, len(lines))
+	}
+	for i, l := range lines {
+		y := first + int64(i)
+		if l.Y != y || l.Text != fmt.Sprintf("l%d", y) {
+			t.Fatalf("page %d: expected line %d but got %d: %q", page, y, l.Y, l.Text)
+		}
+	}
+}
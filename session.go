@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 
 	"marwan.io/iterm2/api"
@@ -11,15 +12,21 @@ import (
 // within a Tab where the terminal is active
 type Session interface {
 	SendText(s string) error
+	SendTextContext(ctx context.Context, s string) error
 	Activate(selectTab, orderWindowFront bool) error
+	ActivateContext(ctx context.Context, selectTab, orderWindowFront bool) error
 	SplitPane(opts SplitPaneOptions) (Session, error)
+	SplitPaneContext(ctx context.Context, opts SplitPaneOptions) (Session, error)
 	GetSessionID() string
-}
-
-// SplitPaneOptions for customizing the new pane session.
-// More options can be added here as needed
-type SplitPaneOptions struct {
-	Vertical bool
+	Screen() (*ScreenContents, error)
+	ScreenContext(ctx context.Context) (*ScreenContents, error)
+	Tail(n int) (*ScreenContents, error)
+	TailContext(ctx context.Context, n int) (*ScreenContents, error)
+	ReadRange(r CoordRange) (*ScreenContents, error)
+	ReadRangeContext(ctx context.Context, r CoordRange) (*ScreenContents, error)
+	Scrollback() *Scrollback
+	Close(force bool) error
+	CloseContext(ctx context.Context, force bool) error
 }
 
 type session struct {
@@ -28,61 +35,60 @@ type session struct {
 }
 
 func (s *session) SendText(t string) error {
-	resp, err := s.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_SendTextRequest{
-			SendTextRequest: &api.SendTextRequest{
-				Session: &s.id,
-				Text:    &t,
-			},
-		},
+	return s.SendTextContext(context.Background(), t)
+}
+
+func (s *session) SendTextContext(ctx context.Context, t string) error {
+	resp, err := s.c.SendText(ctx, &api.SendTextRequest{
+		Session: &s.id,
+		Text:    &t,
 	})
 	if err != nil {
 		return fmt.Errorf("error sending text to session %q: %w", s.id, err)
 	}
-	if status := resp.GetSendTextResponse().GetStatus(); status != api.SendTextResponse_OK {
-		return fmt.Errorf("unexpected status for session %q: %s", s.id, status)
-	}
-	return nil
+	return client.CheckStatus("SendTextRequest", s.id, resp.GetStatus())
 }
 
 func (s *session) Activate(selectTab, orderWindowFront bool) error {
-	resp, err := s.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ActivateRequest{
-			ActivateRequest: &api.ActivateRequest{
-				Identifier: &api.ActivateRequest_SessionId{
-					SessionId: s.id,
-				},
-				SelectTab:        &selectTab,
-				OrderWindowFront: &orderWindowFront,
-			},
+	return s.ActivateContext(context.Background(), selectTab, orderWindowFront)
+}
+
+func (s *session) ActivateContext(ctx context.Context, selectTab, orderWindowFront bool) error {
+	resp, err := s.c.Activate(ctx, &api.ActivateRequest{
+		Identifier: &api.ActivateRequest_SessionId{
+			SessionId: s.id,
 		},
+		SelectTab:        &selectTab,
+		OrderWindowFront: &orderWindowFront,
 	})
 	if err != nil {
 		return fmt.Errorf("error activating session %q: %w", s.id, err)
 	}
-	if status := resp.GetActivateResponse().GetStatus(); status != api.ActivateResponse_OK {
-		return fmt.Errorf("unexpected status for activate request: %s", status)
-	}
-	return nil
+	return client.CheckStatus("ActivateRequest", s.id, resp.GetStatus())
 }
 
 func (s *session) SplitPane(opts SplitPaneOptions) (Session, error) {
-	direction := api.SplitPaneRequest_HORIZONTAL.Enum()
-	if opts.Vertical {
-		direction = api.SplitPaneRequest_VERTICAL.Enum()
+	return s.SplitPaneContext(context.Background(), opts)
+}
+
+func (s *session) SplitPaneContext(ctx context.Context, opts SplitPaneOptions) (Session, error) {
+	props, err := opts.properties()
+	if err != nil {
+		return nil, err
 	}
-	resp, err := s.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_SplitPaneRequest{
-			SplitPaneRequest: &api.SplitPaneRequest{
-				Session:        &s.id,
-				SplitDirection: direction,
-			},
-		},
+	spResp, err := s.c.SplitPane(ctx, &api.SplitPaneRequest{
+		Session:                 &s.id,
+		SplitDirection:          opts.direction(),
+		Before:                  b(opts.Before),
+		ProfileName:             opts.profileName(),
+		CustomProfileProperties: props,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error splitting pane: %w", err)
 	}
-	spResp := resp.GetSplitPaneResponse()
+	if err := client.CheckStatus("SplitPaneRequest", s.id, spResp.GetStatus()); err != nil {
+		return nil, err
+	}
 	if len(spResp.GetSessionId()) < 1 {
 		return nil, fmt.Errorf("expected at least one new session in split pane")
 	}
@@ -0,0 +1,260 @@
+package iterm2
+
+import (
+	"context"
+	"fmt"
+
+	"marwan.io/iterm2/api"
+)
+
+// Snapshot is the state of every window, tab and session
+// of iTerm2 at the time it was taken. It is never updated
+// afterwards and must not be modified by its users, which
+// makes it safe to share between goroutines.
+type Snapshot struct {
+	Windows []*WindowInfo
+	// Buried holds the sessions that were
+	// buried and belong to no tab.
+	Buried []*SessionInfo
+}
+
+// WindowInfo describes a window in a Snapshot.
+type WindowInfo struct {
+	ID string
+	// Number is the number shown in the window's
+	// title and used in keyboard shortcuts.
+	Number int
+	Frame  Frame
+	Tabs   []*TabInfo
+}
+
+// TabInfo describes a tab in a Snapshot.
+type TabInfo struct {
+	ID     string
+	Window *WindowInfo
+	// Root is the tree of split panes that fill the tab.
+	Root *SplitNode
+	// Minimized holds the sessions of the tab that
+	// are not part of its split panes.
+	Minimized []*SessionInfo
+	// TmuxWindowID and TmuxConnectionID are only set
+	// for tabs that belong to a tmux integration.
+	TmuxWindowID     string
+	TmuxConnectionID string
+}
+
+// SplitNode is a group of panes laid out along the same axis.
+// Its children are either sessions or further SplitNodes.
+type SplitNode struct {
+	// Vertical tells whether the dividers between the children
+	// are vertical, that is whether they sit side by side.
+	Vertical bool
+	Parent   *SplitNode
+	Children []SplitChild
+}
+
+// SplitChild is either a session or a nested SplitNode.
+type SplitChild struct {
+	Session *SessionInfo
+	Node    *SplitNode
+}
+
+// SessionInfo describes a session in a Snapshot.
+type SessionInfo struct {
+	ID    string
+	Title string
+	// Frame and GridSize are zero for buried sessions.
+	Frame    Frame
+	GridSize Size
+	// Tab and Window are nil for buried sessions.
+	Tab    *TabInfo
+	Window *WindowInfo
+	// Parent is the split node the session is part of.
+	// It is nil for minimized and buried sessions.
+	Parent    *SplitNode
+	Minimized bool
+	Buried    bool
+}
+
+// Frame is a rectangle in points.
+type Frame struct {
+	Origin Point
+	Size   Size
+}
+
+// Point is a position in points.
+type Point struct {
+	X, Y int
+}
+
+// Size is either a size in points or, for grids, in cells.
+type Size struct {
+	Width, Height int
+}
+
+func (a *app) Snapshot() (*Snapshot, error) {
+	return a.SnapshotContext(context.Background())
+}
+
+func (a *app) SnapshotContext(ctx context.Context) (*Snapshot, error) {
+	resp, err := a.c.ListSessions(ctx, &api.ListSessionsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list sessions: %w", err)
+	}
+	return newSnapshot(resp), nil
+}
+
+func newSnapshot(resp *api.ListSessionsResponse) *Snapshot {
+	snap := &Snapshot{}
+	for _, w := range resp.GetWindows() {
+		wi := &WindowInfo{
+			ID:     w.GetWindowId(),
+			Number: int(w.GetNumber()),
+			Frame:  newFrame(w.GetFrame()),
+		}
+		for _, t := range w.GetTabs() {
+			ti := &TabInfo{
+				ID:               t.GetTabId(),
+				Window:           wi,
+				TmuxWindowID:     t.GetTmuxWindowId(),
+				TmuxConnectionID: t.GetTmuxConnectionId(),
+			}
+			ti.Root = newSplitNode(t.GetRoot(), nil, ti)
+			for _, s := range t.GetMinimizedSessions() {
+				si := newSessionInfo(s)
+				si.Tab = ti
+				si.Window = wi
+				si.Minimized = true
+				ti.Minimized = append(ti.Minimized, si)
+			}
+			wi.Tabs = append(wi.Tabs, ti)
+		}
+		snap.Windows = append(snap.Windows, wi)
+	}
+	for _, s := range resp.GetBuriedSessions() {
+		si := newSessionInfo(s)
+		si.Buried = true
+		snap.Buried = append(snap.Buried, si)
+	}
+	return snap
+}
+
+func newSplitNode(n *api.SplitTreeNode, parent *SplitNode, tab *TabInfo) *SplitNode {
+	node := &SplitNode{Vertical: n.GetVertical(), Parent: parent}
+	for _, l := range n.GetLinks() {
+		switch {
+		case l.GetSession() != nil:
+			si := newSessionInfo(l.GetSession())
+			si.Tab = tab
+			si.Window = tab.Window
+			si.Parent = node
+			node.Children = append(node.Children, SplitChild{Session: si})
+		case l.GetNode() != nil:
+			node.Children = append(node.Children, SplitChild{Node: newSplitNode(l.GetNode(), node, tab)})
+		}
+	}
+	return node
+}
+
+func newSessionInfo(s *api.SessionSummary) *SessionInfo {
+	return &SessionInfo{
+		ID:    s.GetUniqueIdentifier(),
+		Title: s.GetTitle(),
+		Frame: newFrame(s.GetFrame()),
+		GridSize: Size{
+			Width:  int(s.GetGridSize().GetWidth()),
+			Height: int(s.GetGridSize().GetHeight()),
+		},
+	}
+}
+
+func newFrame(f *api.Frame) Frame {
+	return Frame{
+		Origin: Point{X: int(f.GetOrigin().GetX()), Y: int(f.GetOrigin().GetY())},
+		Size:   Size{Width: int(f.GetSize().GetWidth()), Height: int(f.GetSize().GetHeight())},
+	}
+}
+
+// Sessions returns every session of the snapshot: those of each
+// tab in order, followed by the buried ones.
+func (s *Snapshot) Sessions() []*SessionInfo {
+	var list []*SessionInfo
+	for _, w := range s.Windows {
+		list = append(list, w.Sessions()...)
+	}
+	return append(list, s.Buried...)
+}
+
+// Session returns the session with the given id, or nil.
+func (s *Snapshot) Session(id string) *SessionInfo {
+	for _, si := range s.Sessions() {
+		if si.ID == id {
+			return si
+		}
+	}
+	return nil
+}
+
+// Tab returns the tab with the given id, or nil.
+func (s *Snapshot) Tab(id string) *TabInfo {
+	for _, w := range s.Windows {
+		for _, t := range w.Tabs {
+			if t.ID == id {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// Window returns the window with the given id, or nil.
+func (s *Snapshot) Window(id string) *WindowInfo {
+	for _, w := range s.Windows {
+		if w.ID == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// Sessions returns the sessions of every tab of the window.
+func (w *WindowInfo) Sessions() []*SessionInfo {
+	var list []*SessionInfo
+	for _, t := range w.Tabs {
+		list = append(list, t.Sessions()...)
+	}
+	return list
+}
+
+// Sessions returns the split panes of the tab from left to right
+// and top to bottom, followed by its minimized sessions.
+func (t *TabInfo) Sessions() []*SessionInfo {
+	var list []*SessionInfo
+	if t.Root != nil {
+		list = t.Root.Sessions()
+	}
+	return append(list, t.Minimized...)
+}
+
+// Sessions returns every session under n in layout order.
+func (n *SplitNode) Sessions() []*SessionInfo {
+	var list []*SessionInfo
+	n.Walk(func(c SplitChild) bool {
+		if c.Session != nil {
+			list = append(list, c.Session)
+		}
+		return true
+	})
+	return list
+}
+
+// Walk calls fn for every child under n, depth first and in
+// layout order. Returning false from fn for a node skips its
+// children; the walk goes on with its siblings.
+func (n *SplitNode) Walk(fn func(c SplitChild) bool) {
+	for _, c := range n.Children {
+		if fn(c) && c.Node != nil {
+			c.Node.Walk(fn)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package iterm2_test
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"marwan.io/iterm2"
+	"marwan.io/iterm2/api"
+)
+
+func summary(id string, x int32) *api.SessionSummary {
+	return &api.SessionSummary{
+		UniqueIdentifier: proto.String(id),
+		Title:            proto.String("title of " + id),
+		Frame:            frame(x, 0, 100, 50),
+		GridSize:         &api.Size{Width: proto.Int32(80), Height: proto.Int32(25)},
+	}
+}
+
+func frame(x, y, w, h int32) *api.Frame {
+	return &api.Frame{
+		Origin: &api.Point{X: proto.Int32(x), Y: proto.Int32(y)},
+		Size:   &api.Size{Width: proto.Int32(w), Height: proto.Int32(h)},
+	}
+}
+
+func sessionLink(s *api.SessionSummary) *api.SplitTreeNode_SplitTreeLink {
+	return &api.SplitTreeNode_SplitTreeLink{Child: &api.SplitTreeNode_SplitTreeLink_Session{Session: s}}
+}
+
+func TestSnapshot(t *testing.T) {
+	app, srv := newApp(t)
+	// The tab is laid out as V[s1, H[s2, s3]], with s4
+	// minimized, and s5 is buried.
+	resp := &api.ListSessionsResponse{
+		Windows: []*api.ListSessionsResponse_Window{{
+			WindowId: proto.String("w1"),
+			Number:   proto.Int32(3),
+			Frame:    frame(10, 20, 800, 600),
+			Tabs: []*api.ListSessionsResponse_Tab{{
+				TabId:            proto.String("t1"),
+				TmuxWindowId:     proto.String("@1"),
+				TmuxConnectionId: proto.String("c1"),
+				Root: &api.SplitTreeNode{
+					Vertical: proto.Bool(true),
+					Links: []*api.SplitTreeNode_SplitTreeLink{
+						sessionLink(summary("s1", 0)),
+						{Child: &api.SplitTreeNode_SplitTreeLink_Node{Node: &api.SplitTreeNode{
+							Links: []*api.SplitTreeNode_SplitTreeLink{
+								sessionLink(summary("s2", 100)),
+								sessionLink(summary("s3", 100)),
+							},
+						}}},
+					},
+				},
+				MinimizedSessions: []*api.SessionSummary{summary("s4", 0)},
+			}},
+		}},
+		BuriedSessions: []*api.SessionSummary{{
+			UniqueIdentifier: proto.String("s5"),
+			Title:            proto.String("title of s5"),
+		}},
+	}
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetListSessionsRequest() == nil {
+			return nil
+		}
+		return &api.ServerOriginatedMessage{
+			Submessage: &api.ServerOriginatedMessage_ListSessionsResponse{ListSessionsResponse: resp},
+		}
+	})
+	snap, err := app.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(snap.Windows) != 1 {
+		t.Fatalf("expected 1 window but got %d", len(snap.Windows))
+	}
+	w := snap.Windows[0]
+	wantFrame := iterm2.Frame{Origin: iterm2.Point{X: 10, Y: 20}, Size: iterm2.Size{Width: 800, Height: 600}}
+	if w.ID != "w1" || w.Number != 3 || w.Frame != wantFrame {
+		t.Fatalf("unexpected window %+v", w)
+	}
+	if len(w.Tabs) != 1 {
+		t.Fatalf("expected 1 tab but got %d", len(w.Tabs))
+	}
+	tab := w.Tabs[0]
+	if tab.ID != "t1" || tab.Window != w || tab.TmuxWindowID != "@1" || tab.TmuxConnectionID != "c1" {
+		t.Fatalf("unexpected tab %+v", tab)
+	}
+
+	root := tab.Root
+	if !root.Vertical || root.Parent != nil || len(root.Children) != 2 {
+		t.Fatalf("unexpected root %+v", root)
+	}
+	h := root.Children[1].Node
+	if h == nil || h.Vertical || h.Parent != root || len(h.Children) != 2 {
+		t.Fatalf("unexpected nested node %+v", h)
+	}
+
+	tt := []struct {
+		id        string
+		info      *iterm2.SessionInfo
+		tab       *iterm2.TabInfo
+		window    *iterm2.WindowInfo
+		parent    *iterm2.SplitNode
+		minimized bool
+		buried    bool
+		x         int
+	}{
+		{id: "s1", info: root.Children[0].Session, tab: tab, window: w, parent: root},
+		{id: "s2", info: h.Children[0].Session, tab: tab, window: w, parent: h, x: 100},
+		{id: "s3", info: h.Children[1].Session, tab: tab, window: w, parent: h, x: 100},
+		{id: "s4", info: tab.Minimized[0], tab: tab, window: w, minimized: true},
+		{id: "s5", info: snap.Buried[0], buried: true},
+	}
+	for _, tc := range tt {
+		s := tc.info
+		if s == nil || s.ID != tc.id || s.Title != "title of "+tc.id {
+			t.Fatalf("%s: unexpected session %+v", tc.id, s)
+		}
+		if s.Tab != tc.tab || s.Window != tc.window || s.Parent != tc.parent {
+			t.Errorf("%s: unexpected back-pointers: tab %p, window %p, parent %p", tc.id, s.Tab, s.Window, s.Parent)
+		}
+		if s.Minimized != tc.minimized || s.Buried != tc.buried {
+			t.Errorf("%s: expected minimized %v and buried %v but got %v and %v", tc.id, tc.minimized, tc.buried, s.Minimized, s.Buried)
+		}
+		var grid iterm2.Size
+		var f iterm2.Frame
+		if !tc.buried {
+			grid = iterm2.Size{Width: 80, Height: 25}
+			f = iterm2.Frame{Origin: iterm2.Point{X: tc.x}, Size: iterm2.Size{Width: 100, Height: 50}}
+		}
+		if s.GridSize != grid || s.Frame != f {
+			t.Errorf("%s: expected frame %v and grid %v but got %v and %v", tc.id, f, grid, s.Frame, s.GridSize)
+		}
+		if snap.Session(tc.id) != s {
+			t.Errorf("%s: Snapshot.Session did not find the session", tc.id)
+		}
+	}
+	if got := len(snap.Sessions()); got != len(tt) {
+		t.Errorf("expected %d sessions but got %d", len(tt), got)
+	}
+}
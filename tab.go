@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 
 	"marwan.io/iterm2/api"
@@ -10,7 +11,14 @@ import (
 // Tab abstracts an iTerm2 window tab
 type Tab interface {
 	SetTitle(string) error
+	SetTitleContext(context.Context, string) error
 	ListSessions() ([]Session, error)
+	ListSessionsContext(context.Context) ([]Session, error)
+	// Layout returns the tree of split panes that fill the tab.
+	Layout() (*SplitNode, error)
+	LayoutContext(context.Context) (*SplitNode, error)
+	Close(force bool) error
+	CloseContext(ctx context.Context, force bool) error
 }
 
 type tab struct {
@@ -20,50 +28,67 @@ type tab struct {
 }
 
 func (t *tab) SetTitle(s string) error {
-	_, err := t.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
-			InvokeFunctionRequest: &api.InvokeFunctionRequest{
-				Invocation: str(fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)),
-				Context: &api.InvokeFunctionRequest_Method_{
-					Method: &api.InvokeFunctionRequest_Method{
-						Receiver: &t.id,
-					},
-				},
+	return t.SetTitleContext(context.Background(), s)
+}
+
+func (t *tab) SetTitleContext(ctx context.Context, s string) error {
+	resp, err := t.c.InvokeFunction(ctx, &api.InvokeFunctionRequest{
+		Invocation: str(fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)),
+		Context: &api.InvokeFunctionRequest_Method_{
+			Method: &api.InvokeFunctionRequest_Method{
+				Receiver: &t.id,
 			},
 		},
 	})
 	if err != nil {
 		return fmt.Errorf("could not call set_title: %w", err)
 	}
-	return nil
+	return invokeError(t.id, resp)
 }
 
 func (t *tab) ListSessions() ([]Session, error) {
+	return t.ListSessionsContext(context.Background())
+}
+
+func (t *tab) ListSessionsContext(ctx context.Context) ([]Session, error) {
 	list := []Session{}
-	resp, err := t.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
-			ListSessionsRequest: &api.ListSessionsRequest{},
-		},
-	})
+	snap, err := t.snapshot(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("error listing sessions for tab %q: %w", t.id, err)
+		return nil, err
+	}
+	ti := snap.Tab(t.id)
+	if ti == nil {
+		return list, nil
 	}
-	lsr := resp.GetListSessionsResponse()
-	for _, window := range lsr.GetWindows() {
-		if window.GetWindowId() != t.windowID {
-			continue
-		}
-		for _, wt := range window.GetTabs() {
-			if wt.GetTabId() != t.id {
-				continue
-			}
-			for _, link := range wt.GetRoot().GetLinks() {
-				list = append(list, &session{
-					c:  t.c,
-					id: link.GetSession().GetUniqueIdentifier(),
-				})
-			}
-		}
+	for _, s := range ti.Root.Sessions() {
+		list = append(list, &session{
+			c:  t.c,
+			id: s.ID,
+		})
 	}
 	return list, nil
 }
+
+func (t *tab) Layout() (*SplitNode, error) {
+	return t.LayoutContext(context.Background())
+}
+
+func (t *tab) LayoutContext(ctx context.Context) (*SplitNode, error) {
+	snap, err := t.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ti := snap.Tab(t.id)
+	if ti == nil {
+		return nil, fmt.Errorf("tab %q not found", t.id)
+	}
+	return ti.Root, nil
+}
+
+func (t *tab) snapshot(ctx context.Context) (*Snapshot, error) {
+	lsr, err := t.c.ListSessions(ctx, &api.ListSessionsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions for tab %q: %w", t.id, err)
+	}
+	return newSnapshot(lsr), nil
+}
@@ -0,0 +1,95 @@
+package iterm2_test
+
+import (
+	"testing"
+
+	"marwan.io/iterm2"
+)
+
+func TestNestedLayout(t *testing.T) {
+	app, _ := newApp(t)
+	w, err := app.CreateWindow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tabs, err := w.ListTabs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab := tabs[0]
+	sessions, err := tab.ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s0 := sessions[0]
+	s1, err := s0.SplitPane(iterm2.SplitPaneOptions{Direction: iterm2.SplitVertical})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := s1.SplitPane(iterm2.SplitPaneOptions{Direction: iterm2.SplitHorizontal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3, err := s2.SplitPane(iterm2.SplitPaneOptions{Direction: iterm2.SplitVertical})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err = tab.ListSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []iterm2.Session{s0, s1, s2, s3}
+	if len(sessions) != len(want) {
+		t.Fatalf("expected %d sessions but got %d", len(want), len(sessions))
+	}
+	for i, s := range sessions {
+		if s.GetSessionID() != want[i].GetSessionID() {
+			t.Fatalf("session %d: expected %q but got %q", i, want[i].GetSessionID(), s.GetSessionID())
+		}
+	}
+
+	// The tab is laid out as V[s0, H[s1, V[s2, s3]]].
+	root, err := tab.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNode(t, "root", root, nil, true, 2)
+	checkSession(t, "root[0]", root.Children[0], s0, root)
+	h := root.Children[1].Node
+	checkNode(t, "root[1]", h, root, false, 2)
+	checkSession(t, "root[1][0]", h.Children[0], s1, h)
+	v := h.Children[1].Node
+	checkNode(t, "root[1][1]", v, h, true, 2)
+	checkSession(t, "root[1][1][0]", v.Children[0], s2, v)
+	checkSession(t, "root[1][1][1]", v.Children[1], s3, v)
+}
+
+func checkNode(t *testing.T, path string, n, parent *iterm2.SplitNode, vertical bool, children int) {
+	t.Helper()
+	if n == nil {
+		t.Fatalf("%s: expected a split node", path)
+	}
+	if n.Parent != parent {
+		t.Fatalf("%s: wrong parent", path)
+	}
+	if n.Vertical != vertical {
+		t.Fatalf("%s: expected vertical to be %v", path, vertical)
+	}
+	if len(n.Children) != children {
+		t.Fatalf("%s: expected %d children but got %d", path, children, len(n.Children))
+	}
+}
+
+func checkSession(t *testing.T, path string, c iterm2.SplitChild, s iterm2.Session, parent *iterm2.SplitNode) {
+	t.Helper()
+	if c.Session == nil {
+		t.Fatalf("%s: expected a session", path)
+	}
+	if c.Session.ID != s.GetSessionID() {
+		t.Fatalf("%s: expected session %q but got %q", path, s.GetSessionID(), c.Session.ID)
+	}
+	if c.Session.Parent != parent {
+		t.Fatalf("%s: wrong parent", path)
+	}
+}
@@ -0,0 +1,95 @@
+package iterm2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"marwan.io/iterm2/api"
+	"marwan.io/iterm2/client"
+)
+
+// ErrNestedTransaction is returned by Transaction when
+// the App is already running a transaction.
+var ErrNestedTransaction = errors.New("transaction already in progress")
+
+// cleanupTimeout bounds the requests that clean up after the caller,
+// such as ending a transaction, which cannot use the caller's
+// context since that may be done already.
+var cleanupTimeout = 5 * time.Second
+
+// Tx is the App as seen from inside a transaction. Every
+// request made through it, or through the windows, tabs and
+// sessions it returns, runs while iTerm2 is frozen.
+type Tx interface {
+	CreateWindowContext(ctx context.Context) (Window, error)
+	CreateWindowWithOptionsContext(ctx context.Context, opts CreateWindowOptions) (Window, error)
+	ListWindowsContext(ctx context.Context) ([]Window, error)
+	SnapshotContext(ctx context.Context) (*Snapshot, error)
+	SelectMenuItemContext(ctx context.Context, item string) error
+	ActivateContext(ctx context.Context, raiseAllWindows, ignoreOtherApps bool) error
+
+	// Client returns the underlying client for requests that
+	// the library has no method for, such as SetTabLayout.
+	Client() *client.Client
+}
+
+type tx struct {
+	*app
+}
+
+func (t tx) Client() *client.Client {
+	return t.c
+}
+
+// Transaction runs fn while iTerm2's main loop is frozen so that
+// everything fn reads and changes sees a consistent state. The
+// transaction ends once fn returns, even if it fails or panics.
+// iTerm2 stops serving everyone else in the meantime, so fn should
+// be quick. Transactions do not nest: calling Transaction while one
+// is in progress returns ErrNestedTransaction.
+func (a *app) Transaction(ctx context.Context, fn func(tx Tx) error) (err error) {
+	if !atomic.CompareAndSwapInt32(&a.inTx, 0, 1) {
+		return ErrNestedTransaction
+	}
+	defer atomic.StoreInt32(&a.inTx, 0)
+	if err := a.transaction(ctx, true); err != nil {
+		var statusErr *client.StatusError
+		if !errors.As(err, &statusErr) {
+			// The begin request may have reached iTerm2 before
+			// ctx was done, so end what may have begun.
+			endErr := a.endTransaction()
+			if endErr != nil && !errors.Is(endErr, client.ErrNoTransaction) {
+				err = fmt.Errorf("%w (could not end transaction: %v)", err, endErr)
+			}
+		}
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer func() {
+		// Ended regardless of ctx: a cancelled ctx must
+		// not leave iTerm2 frozen.
+		endErr := a.endTransaction()
+		if endErr != nil && err == nil {
+			err = fmt.Errorf("could not end transaction: %w", endErr)
+		}
+	}()
+	return fn(tx{a})
+}
+
+// endTransaction ends the transaction regardless of the caller's
+// context and gives up once iTerm2 takes longer than cleanupTimeout.
+func (a *app) endTransaction() error {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	return a.transaction(ctx, false)
+}
+
+func (a *app) transaction(ctx context.Context, begin bool) error {
+	resp, err := a.c.Transaction(ctx, &api.TransactionRequest{Begin: &begin})
+	if err != nil {
+		return err
+	}
+	return client.CheckStatus("TransactionRequest", "", resp.GetStatus())
+}
@@ -0,0 +1,77 @@
+package iterm2_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"marwan.io/iterm2"
+	"marwan.io/iterm2/api"
+)
+
+func TestTransactionBeginTimeout(t *testing.T) {
+	app, srv := newApp(t)
+	// Begin requests reach the model only after the
+	// caller stopped waiting for their response.
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if req.GetTransactionRequest().GetBegin() {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := app.Transaction(ctx, func(iterm2.Tx) error {
+		t.Fatal("fn ran although the transaction could not begin")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error but got %v", err)
+	}
+
+	// Requests are served in order, so the begin
+	// request has been served once this returns.
+	if _, err := app.ListWindows(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := iterm2.NewAppWithOptions("other", srv.Options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := other.ListWindowsContext(ctx); err != nil {
+		t.Fatalf("iTerm2 was left frozen: %v", err)
+	}
+}
+
+func TestTransactionEndTimeout(t *testing.T) {
+	defer iterm2.SetCleanupTimeout(50 * time.Millisecond)()
+	app, srv := newApp(t)
+	// iTerm2 never answers the request that ends the transaction.
+	release := make(chan struct{})
+	defer close(release)
+	srv.Handle(func(req *api.ClientOriginatedMessage) *api.ServerOriginatedMessage {
+		if tr := req.GetTransactionRequest(); tr != nil && !tr.GetBegin() {
+			<-release
+		}
+		return nil
+	})
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Transaction(context.Background(), func(iterm2.Tx) error {
+			return nil
+		})
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a deadline error but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Transaction hung while ending the transaction")
+	}
+}
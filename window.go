@@ -1,6 +1,7 @@
 package iterm2
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
@@ -11,9 +12,17 @@ import (
 // Window represents an iTerm2 Window
 type Window interface {
 	SetTitle(s string) error
+	SetTitleContext(ctx context.Context, s string) error
 	CreateTab() (Tab, error)
+	CreateTabContext(ctx context.Context) (Tab, error)
+	CreateTabWithOptions(opts CreateTabOptions) (Tab, error)
+	CreateTabWithOptionsContext(ctx context.Context, opts CreateTabOptions) (Tab, error)
 	ListTabs() ([]Tab, error)
+	ListTabsContext(ctx context.Context) ([]Tab, error)
 	Activate() error
+	ActivateContext(ctx context.Context) error
+	Close(force bool) error
+	CloseContext(ctx context.Context, force bool) error
 }
 
 type window struct {
@@ -23,38 +32,67 @@ type window struct {
 }
 
 func (w *window) CreateTab() (Tab, error) {
-	resp, err := w.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_CreateTabRequest{
-			CreateTabRequest: &api.CreateTabRequest{
-				WindowId: str(w.id),
-			},
-		},
-	})
+	return w.CreateTabContext(context.Background())
+}
+
+func (w *window) CreateTabContext(ctx context.Context) (Tab, error) {
+	return w.CreateTabWithOptionsContext(ctx, CreateTabOptions{})
+}
+
+func (w *window) CreateTabWithOptions(opts CreateTabOptions) (Tab, error) {
+	return w.CreateTabWithOptionsContext(context.Background(), opts)
+}
+
+// CreateTabWithOptionsContext returns the new tab along with an
+// ErrInvalidTabIndex error when the tab could not be put at
+// opts.Index.
+func (w *window) CreateTabWithOptionsContext(ctx context.Context, opts CreateTabOptions) (Tab, error) {
+	props, err := opts.properties()
 	if err != nil {
-		return nil, fmt.Errorf("could not create tab for window %q: %w", w.id, err)
+		return nil, err
+	}
+	req := &api.CreateTabRequest{
+		WindowId:                str(w.id),
+		ProfileName:             opts.profileName(),
+		CustomProfileProperties: props,
+	}
+	if opts.Index != nil {
+		if *opts.Index < 0 {
+			return nil, fmt.Errorf("invalid tab index %d: %w", *opts.Index, client.ErrInvalidTabIndex)
+		}
+		idx := uint32(*opts.Index)
+		req.TabIndex = &idx
 	}
-	ctr := resp.GetCreateTabResponse()
-	if ctr.GetStatus() != api.CreateTabResponse_OK {
-		return nil, fmt.Errorf("unexpected tab status: %s", ctr.GetStatus())
+	ctr, err := w.c.CreateTab(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("could not create tab for window %q: %w", w.id, err)
 	}
-	return &tab{
+	t := &tab{
 		c:        w.c,
 		id:       strconv.Itoa(int(ctr.GetTabId())),
 		windowID: w.id,
-	}, nil
+	}
+	err = client.CheckStatus("CreateTabRequest", w.id, ctr.GetStatus())
+	if ctr.GetStatus() == api.CreateTabResponse_INVALID_TAB_INDEX {
+		return t, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
 func (w *window) ListTabs() ([]Tab, error) {
+	return w.ListTabsContext(context.Background())
+}
+
+func (w *window) ListTabsContext(ctx context.Context) ([]Tab, error) {
 	list := []Tab{}
-	resp, err := w.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ListSessionsRequest{
-			ListSessionsRequest: &api.ListSessionsRequest{},
-		},
-	})
+	resp, err := w.c.ListSessions(ctx, &api.ListSessionsRequest{})
 	if err != nil {
 		return nil, fmt.Errorf("could not list sessions: %w", err)
 	}
-	for _, window := range resp.GetListSessionsResponse().GetWindows() {
+	for _, window := range resp.GetWindows() {
 		if window.GetWindowId() != w.id {
 			continue
 		}
@@ -70,27 +108,35 @@ func (w *window) ListTabs() ([]Tab, error) {
 }
 
 func (w *window) SetTitle(s string) error {
-	_, err := w.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_InvokeFunctionRequest{
-			InvokeFunctionRequest: &api.InvokeFunctionRequest{
-				Invocation: str(fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)),
-				Context: &api.InvokeFunctionRequest_Method_{
-					Method: &api.InvokeFunctionRequest_Method{
-						Receiver: &w.id,
-					},
-				},
+	return w.SetTitleContext(context.Background(), s)
+}
+
+func (w *window) SetTitleContext(ctx context.Context, s string) error {
+	resp, err := w.c.InvokeFunction(ctx, &api.InvokeFunctionRequest{
+		Invocation: str(fmt.Sprintf(`iterm2.set_title(title: "%s")`, s)),
+		Context: &api.InvokeFunctionRequest_Method_{
+			Method: &api.InvokeFunctionRequest_Method{
+				Receiver: &w.id,
 			},
 		},
 	})
-	return err
+	if err != nil {
+		return fmt.Errorf("could not call set_title: %w", err)
+	}
+	return invokeError(w.id, resp)
 }
 
 func (w *window) Activate() error {
-	_, err := w.c.Call(&api.ClientOriginatedMessage{
-		Submessage: &api.ClientOriginatedMessage_ActivateRequest{ActivateRequest: &api.ActivateRequest{
-			Identifier:       &api.ActivateRequest_WindowId{WindowId: w.id},
-			OrderWindowFront: b(true),
-		}},
+	return w.ActivateContext(context.Background())
+}
+
+func (w *window) ActivateContext(ctx context.Context) error {
+	resp, err := w.c.Activate(ctx, &api.ActivateRequest{
+		Identifier:       &api.ActivateRequest_WindowId{WindowId: w.id},
+		OrderWindowFront: b(true),
 	})
-	return err
+	if err != nil {
+		return fmt.Errorf("error activating window %q: %w", w.id, err)
+	}
+	return client.CheckStatus("ActivateRequest", w.id, resp.GetStatus())
 }